@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/lager"
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/ssh"
@@ -28,13 +29,39 @@ type AppSSHResponse struct {
 	ProcessGuid string `json:"process_guid"`
 }
 
+type ccRelationship struct {
+	Data struct {
+		Guid string `json:"guid"`
+	} `json:"data"`
+}
+
+type ccResource struct {
+	Guid          string                    `json:"guid"`
+	Name          string                    `json:"name"`
+	Relationships map[string]ccRelationship `json:"relationships"`
+}
+
+type ccAppResponse struct {
+	ccResource
+	Included struct {
+		Spaces        []ccResource `json:"spaces"`
+		Organizations []ccResource `json:"organizations"`
+	} `json:"included"`
+}
+
 type UAAAuthTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type"`
 }
 
+const CFRealm = "cf"
+
 var CFUserRegex *regexp.Regexp = regexp.MustCompile(`cf:([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})/(\d+)`)
 
+// accessTokenRegex matches passwords that look like OAuth access tokens
+// (optionally prefixed with the token type) rather than one-time codes.
+var accessTokenRegex *regexp.Regexp = regexp.MustCompile(`^(?i:bearer\s+)?[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$`)
+
 func NewCFAuthenticator(
 	logger lager.Logger,
 	httpClient *http.Client,
@@ -55,6 +82,10 @@ func NewCFAuthenticator(
 	}
 }
 
+func (cfa *CFAuthenticator) Realm() string {
+	return CFRealm
+}
+
 func (cfa *CFAuthenticator) UserRegexp() *regexp.Regexp {
 	return CFUserRegex
 }
@@ -79,6 +110,11 @@ func (cfa *CFAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []b
 		return nil, InvalidCredentialsErr
 	}
 
+	if accessTokenRegex.Match(password) {
+		logger.Error("password-is-access-token", AccessTokenNotAllowedErr)
+		return nil, AccessTokenNotAllowedErr
+	}
+
 	cred, err := cfa.exchangeAccessCodeForToken(logger, string(password))
 	if err != nil {
 		return nil, err
@@ -115,7 +151,16 @@ func (cfa *CFAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []b
 		return nil, err
 	}
 
-	permissions, err := cfa.permissionsBuilder.Build(logger, processGuid, index, metadata)
+	fetchAppMetadata := func(logger lager.Logger) (*proxy.AppMetadata, error) {
+		return cfa.fetchAppMetadata(logger, appGuid, cred)
+	}
+
+	user := username
+	if user == "unknown" {
+		user = metadata.User()
+	}
+
+	permissions, err := cfa.permissionsBuilder.Build(logger, processGuid, index, metadata, user, fetchAppMetadata)
 	if err != nil {
 		logger.Error("building-ssh-permissions-failed", err)
 	}
@@ -147,6 +192,13 @@ func (cfa *CFAuthenticator) exchangeAccessCodeForToken(logger lager.Logger, code
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		logger.Error("code-rejected", InvalidCredentialsErr, lager.Data{
+			"status-code": resp.StatusCode,
+		})
+		return "", InvalidCredentialsErr
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("response-status-not-ok", AuthenticationFailedErr, lager.Data{
 			"status-code": resp.StatusCode,
@@ -198,3 +250,57 @@ func (cfa *CFAuthenticator) checkAccess(logger lager.Logger, appGuid string, ind
 
 	return app.ProcessGuid, nil
 }
+
+func (cfa *CFAuthenticator) fetchAppMetadata(logger lager.Logger, appGuid string, token string) (*proxy.AppMetadata, error) {
+	logger = logger.Session("fetch-app-metadata")
+
+	path := fmt.Sprintf("%s/v3/apps/%s?include=space.organization", cfa.ccURL, appGuid)
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, InvalidRequestErr
+	}
+	req.Header.Add("Authorization", token)
+
+	resp, err := cfa.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("response-status-not-ok", FetchAppFailedErr, lager.Data{
+			"status-code": resp.StatusCode,
+		})
+		return nil, FetchAppFailedErr
+	}
+
+	var app ccAppResponse
+	err = json.NewDecoder(resp.Body).Decode(&app)
+	if err != nil {
+		return nil, InvalidCCResponse
+	}
+
+	appMetadata := &proxy.AppMetadata{
+		AppGuid:   app.Guid,
+		AppName:   app.Name,
+		SpaceGuid: app.Relationships["space"].Data.Guid,
+	}
+
+	for _, space := range app.Included.Spaces {
+		if space.Guid == appMetadata.SpaceGuid {
+			appMetadata.SpaceName = space.Name
+			appMetadata.OrganizationGuid = space.Relationships["organization"].Data.Guid
+			break
+		}
+	}
+
+	for _, org := range app.Included.Organizations {
+		if org.Guid == appMetadata.OrganizationGuid {
+			appMetadata.OrganizationName = org.Name
+			break
+		}
+	}
+
+	return appMetadata, nil
+}
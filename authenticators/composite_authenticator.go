@@ -1,29 +1,42 @@
 package authenticators
 
 import (
-	"regexp"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// CompositeAuthenticator dispatches authentication to exactly one
+// authenticator selected by the realm prefix of the user name (the text
+// before the first ':'). Authenticators are never tried in turn.
 type CompositeAuthenticator struct {
-	authenticators map[*regexp.Regexp]PasswordAuthenticator
+	authenticators map[string]PasswordAuthenticator
 }
 
 func NewCompositeAuthenticator(passwordAuthenticators ...PasswordAuthenticator) *CompositeAuthenticator {
-	authenticators := map[*regexp.Regexp]PasswordAuthenticator{}
+	authenticators := map[string]PasswordAuthenticator{}
 	for _, a := range passwordAuthenticators {
-		authenticators[a.UserRegexp()] = a
+		authenticators[a.Realm()] = a
 	}
 	return &CompositeAuthenticator{authenticators: authenticators}
 }
 
 func (a *CompositeAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
-	for userRegexp, authenticator := range a.authenticators {
-		if userRegexp.MatchString(metadata.User()) {
-			return authenticator.Authenticate(metadata, password)
-		}
+	user := metadata.User()
+
+	parts := strings.SplitN(user, ":", 2)
+	if len(parts) != 2 {
+		return nil, InvalidUserFormatErr
+	}
+
+	authenticator, ok := a.authenticators[parts[0]]
+	if !ok {
+		return nil, InvalidDomainErr
+	}
+
+	if !authenticator.UserRegexp().MatchString(user) {
+		return nil, InvalidUserFormatErr
 	}
 
-	return nil, InvalidCredentialsErr
+	return authenticator.Authenticate(metadata, password)
 }
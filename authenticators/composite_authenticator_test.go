@@ -32,9 +32,13 @@ var _ = Describe("CompositeAuthenticator", func() {
 		})
 
 		Context("when no authenticators are specified", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("one:garbage")
+			})
+
 			It("fails to authenticate", func() {
 				_, err := authenticator.Authenticate(metadata, password)
-				Expect(err).To(Equal(authenticators.InvalidCredentialsErr))
+				Expect(err).To(Equal(authenticators.InvalidDomainErr))
 			})
 		})
 
@@ -46,10 +50,12 @@ var _ = Describe("CompositeAuthenticator", func() {
 
 			BeforeEach(func() {
 				authenticatorOne = &fake_authenticators.FakePasswordAuthenticator{}
-				authenticatorOne.UserRegexpReturns(regexp.MustCompile("one:.*"))
+				authenticatorOne.RealmReturns("one")
+				authenticatorOne.UserRegexpReturns(regexp.MustCompile("one:.+"))
 
 				authenticatorTwo = &fake_authenticators.FakePasswordAuthenticator{}
-				authenticatorTwo.UserRegexpReturns(regexp.MustCompile("two:.*"))
+				authenticatorTwo.RealmReturns("two")
+				authenticatorTwo.UserRegexpReturns(regexp.MustCompile("two:.+"))
 
 				authens = []authenticators.PasswordAuthenticator{
 					authenticatorOne,
@@ -104,7 +110,22 @@ var _ = Describe("CompositeAuthenticator", func() {
 				})
 			})
 
-			Context("and the user realm is not valid", func() {
+			Context("and the users realm matches the second authenticator", func() {
+				BeforeEach(func() {
+					metadata.UserReturns("two:garbage")
+					authenticatorTwo.AuthenticateReturns(&ssh.Permissions{}, nil)
+				})
+
+				It("authenticates with only the second authenticator", func() {
+					_, err := authenticator.Authenticate(metadata, password)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(authenticatorOne.AuthenticateCallCount()).To(Equal(0))
+					Expect(authenticatorTwo.AuthenticateCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("and the user does not contain a realm", func() {
 				BeforeEach(func() {
 					metadata.UserReturns("one")
 				})
@@ -112,7 +133,21 @@ var _ = Describe("CompositeAuthenticator", func() {
 				It("fails to authenticate", func() {
 					_, err := authenticator.Authenticate(metadata, password)
 
-					Expect(err).To(Equal(authenticators.InvalidCredentialsErr))
+					Expect(err).To(Equal(authenticators.InvalidUserFormatErr))
+					Expect(authenticatorOne.AuthenticateCallCount()).To(Equal(0))
+					Expect(authenticatorTwo.AuthenticateCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("and the user realm matches but the user is malformed for that realm", func() {
+				BeforeEach(func() {
+					metadata.UserReturns("one:")
+				})
+
+				It("fails to authenticate", func() {
+					_, err := authenticator.Authenticate(metadata, password)
+
+					Expect(err).To(Equal(authenticators.InvalidUserFormatErr))
 					Expect(authenticatorOne.AuthenticateCallCount()).To(Equal(0))
 					Expect(authenticatorTwo.AuthenticateCallCount()).To(Equal(0))
 				})
@@ -126,7 +161,7 @@ var _ = Describe("CompositeAuthenticator", func() {
 				It("fails to authenticate", func() {
 					_, err := authenticator.Authenticate(metadata, password)
 
-					Expect(err).To(Equal(authenticators.InvalidCredentialsErr))
+					Expect(err).To(Equal(authenticators.InvalidDomainErr))
 					Expect(authenticatorOne.AuthenticateCallCount()).To(Equal(0))
 					Expect(authenticatorTwo.AuthenticateCallCount()).To(Equal(0))
 				})
@@ -1,34 +1,64 @@
 package authenticators
 
 import (
-	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 	"golang.org/x/crypto/ssh"
 )
 
+const DiegoRealm = "diego"
+
 var DiegoUserRegex *regexp.Regexp = regexp.MustCompile(`diego:([a-zA-Z0-9_-]+)/(\d+)`)
 
 type DiegoProxyAuthenticator struct {
 	logger             lager.Logger
-	credentials        []byte
+	secret             []byte
 	permissionsBuilder PermissionsBuilder
+	clock              clock.Clock
 }
 
 func NewDiegoProxyAuthenticator(
 	logger lager.Logger,
-	credentials []byte,
+	secret []byte,
 	permissionsBuilder PermissionsBuilder,
+	clock clock.Clock,
 ) *DiegoProxyAuthenticator {
 	return &DiegoProxyAuthenticator{
 		logger:             logger,
-		credentials:        credentials,
+		secret:             secret,
 		permissionsBuilder: permissionsBuilder,
+		clock:              clock,
 	}
 }
 
+// NewDiegoCredentials creates a password that grants access to the instances
+// of processGuid until expiresAt. The password has the form
+// <process-guid>:<expires-at>:<signature> where the signature is an HMAC-SHA256
+// of the first two fields keyed with secret.
+func NewDiegoCredentials(secret []byte, processGuid string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s:%d", processGuid, expiresAt.Unix())
+	return payload + ":" + signDiegoCredentials(secret, payload)
+}
+
+func signDiegoCredentials(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (dpa *DiegoProxyAuthenticator) Realm() string {
+	return DiegoRealm
+}
+
 func (dpa *DiegoProxyAuthenticator) UserRegexp() *regexp.Regexp {
 	return DiegoUserRegex
 }
@@ -43,11 +73,6 @@ func (dpa *DiegoProxyAuthenticator) Authenticate(metadata ssh.ConnMetadata, pass
 		return nil, InvalidDomainErr
 	}
 
-	if !bytes.Equal(dpa.credentials, password) {
-		logger.Error("invalid-credentials", InvalidCredentialsErr)
-		return nil, InvalidCredentialsErr
-	}
-
 	guidAndIndex := DiegoUserRegex.FindStringSubmatch(metadata.User())
 
 	processGuid := guidAndIndex[1]
@@ -57,9 +82,51 @@ func (dpa *DiegoProxyAuthenticator) Authenticate(metadata ssh.ConnMetadata, pass
 		return nil, err
 	}
 
-	permissions, err := dpa.permissionsBuilder.Build(logger, processGuid, index, metadata)
+	err = dpa.verifyCredentials(logger, processGuid, string(password))
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := dpa.permissionsBuilder.Build(logger, processGuid, index, metadata, metadata.User(), nil)
 	if err != nil {
 		logger.Error("building-ssh-permissions-failed", err)
 	}
 	return permissions, err
 }
+
+func (dpa *DiegoProxyAuthenticator) verifyCredentials(logger lager.Logger, processGuid string, credentials string) error {
+	parts := strings.Split(credentials, ":")
+	if len(parts) != 3 {
+		logger.Error("malformed-credentials", InvalidCredentialsErr)
+		return InvalidCredentialsErr
+	}
+
+	payload := parts[0] + ":" + parts[1]
+	expected := signDiegoCredentials(dpa.secret, payload)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		logger.Error("invalid-credentials", InvalidCredentialsErr)
+		return InvalidCredentialsErr
+	}
+
+	if parts[0] != processGuid {
+		logger.Error("process-guid-mismatch", InvalidCredentialsErr, lager.Data{
+			"credential-process-guid": parts[0],
+		})
+		return InvalidCredentialsErr
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		logger.Error("parse-expiry-failed", err)
+		return InvalidCredentialsErr
+	}
+
+	if !dpa.clock.Now().Before(time.Unix(expiresAt, 0)) {
+		logger.Error("credentials-expired", ExpiredCredentialsErr, lager.Data{
+			"expired-at": expiresAt,
+		})
+		return ExpiredCredentialsErr
+	}
+
+	return nil
+}
@@ -2,7 +2,10 @@ package authenticators_test
 
 import (
 	"regexp"
+	"strings"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/diego-ssh/authenticators"
 	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
 	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
@@ -16,7 +19,8 @@ import (
 var _ = Describe("DiegoProxyAuthenticator", func() {
 	var (
 		logger             *lagertest.TestLogger
-		credentials        []byte
+		secret             []byte
+		fakeClock          *fakeclock.FakeClock
 		permissionsBuilder *fake_authenticators.FakePermissionsBuilder
 		authenticator      *authenticators.DiegoProxyAuthenticator
 		metadata           *fake_ssh.FakeConnMetadata
@@ -24,10 +28,11 @@ var _ = Describe("DiegoProxyAuthenticator", func() {
 
 	BeforeEach(func() {
 		logger = lagertest.NewTestLogger("test")
-		credentials = []byte("some-user:some-password")
+		secret = []byte("some-secret")
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
 		permissionsBuilder = &fake_authenticators.FakePermissionsBuilder{}
 		permissionsBuilder.BuildReturns(&ssh.Permissions{}, nil)
-		authenticator = authenticators.NewDiegoProxyAuthenticator(logger, credentials, permissionsBuilder)
+		authenticator = authenticators.NewDiegoProxyAuthenticator(logger, secret, permissionsBuilder, fakeClock)
 
 		metadata = &fake_ssh.FakeConnMetadata{}
 	})
@@ -49,19 +54,21 @@ var _ = Describe("DiegoProxyAuthenticator", func() {
 		Context("when the user name matches the user regex and valid credentials are provided", func() {
 			BeforeEach(func() {
 				metadata.UserReturns("diego:some-guid/0")
-				password = []byte("some-user:some-password")
+				password = []byte(authenticators.NewDiegoCredentials(secret, "some-guid", fakeClock.Now().Add(time.Minute)))
 			})
 
-			It("authenticates the password against the provided user:password", func() {
+			It("authenticates the signed credentials", func() {
 				Expect(authErr).NotTo(HaveOccurred())
 			})
 
 			It("builds permissions for the requested process", func() {
 				Expect(permissionsBuilder.BuildCallCount()).To(Equal(1))
-				_, guid, index, metadata := permissionsBuilder.BuildArgsForCall(0)
+				_, guid, index, metadata, user, fetchAppMetadata := permissionsBuilder.BuildArgsForCall(0)
 				Expect(guid).To(Equal("some-guid"))
 				Expect(index).To(Equal(0))
 				Expect(metadata).To(Equal(metadata))
+				Expect(user).To(Equal("diego:some-guid/0"))
+				Expect(fetchAppMetadata).To(BeNil())
 			})
 		})
 
@@ -75,7 +82,7 @@ var _ = Describe("DiegoProxyAuthenticator", func() {
 			})
 		})
 
-		Context("when the password doesn't match the provided credentials", func() {
+		Context("when the password is not a signed credential", func() {
 			BeforeEach(func() {
 				metadata.UserReturns("diego:some-guid/0")
 				password = []byte("cf-user:cf-password")
@@ -83,8 +90,63 @@ var _ = Describe("DiegoProxyAuthenticator", func() {
 
 			It("fails the authentication", func() {
 				Expect(authErr).To(MatchError("Invalid credentials"))
+				Expect(permissionsBuilder.BuildCallCount()).To(Equal(0))
 			})
 		})
+
+		Context("when the credentials are signed with a different secret", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("diego:some-guid/0")
+				password = []byte(authenticators.NewDiegoCredentials([]byte("other-secret"), "some-guid", fakeClock.Now().Add(time.Minute)))
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(MatchError("Invalid credentials"))
+				Expect(permissionsBuilder.BuildCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the credentials were issued for a different process", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("diego:some-guid/0")
+				password = []byte(authenticators.NewDiegoCredentials(secret, "other-guid", fakeClock.Now().Add(time.Minute)))
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(MatchError("Invalid credentials"))
+				Expect(permissionsBuilder.BuildCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the credentials have expired", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("diego:some-guid/0")
+				password = []byte(authenticators.NewDiegoCredentials(secret, "some-guid", fakeClock.Now()))
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.ExpiredCredentialsErr))
+				Expect(permissionsBuilder.BuildCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the expiry has been tampered with", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("diego:some-guid/0")
+				signed := authenticators.NewDiegoCredentials(secret, "some-guid", fakeClock.Now())
+				password = []byte(strings.Replace(signed, ":1000:", ":9999999999:", 1))
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(MatchError("Invalid credentials"))
+			})
+		})
+	})
+
+	Describe("Realm", func() {
+		It("is the diego realm", func() {
+			Expect(authenticator.Realm()).To(Equal("diego"))
+		})
 	})
 
 	Describe("UserRegexp", func() {
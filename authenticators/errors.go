@@ -2,13 +2,18 @@ package authenticators
 
 import "errors"
 
+var AccessTokenNotAllowedErr = errors.New("Access tokens are not accepted as passwords")
+var AccessDeniedErr = errors.New("Access denied by authorization policy")
 var AuthenticationFailedErr = errors.New("Authentication failed")
+var ExpiredCredentialsErr = errors.New("Credentials have expired")
 var FetchAppFailedErr = errors.New("Fetching application data failed")
 var InvalidCCResponse = errors.New("Invalid response from Cloud Controller")
 var InvalidCredentialsErr error = errors.New("Invalid credentials")
 var InvalidDomainErr error = errors.New("Invalid authentication domain")
 var InvalidRequestErr = errors.New("CloudController URL Invalid")
 var InvalidUserFormatErr = errors.New("Invalid user format")
+var LockedOutErr = errors.New("Too many failed authentication attempts")
 var NotDiegoErr = errors.New("Diego Not Enabled")
 var RouteNotFoundErr error = errors.New("SSH routing info not found")
 var SSHDisabledErr = errors.New("SSH Disabled")
+var UnknownTargetErr = errors.New("Unknown target")
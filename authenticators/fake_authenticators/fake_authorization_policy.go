@@ -0,0 +1,79 @@
+// This file was generated by counterfeiter
+package fake_authenticators
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/lager"
+)
+
+type FakeAuthorizationPolicy struct {
+	AuthorizeStub        func(logger lager.Logger, request authenticators.AuthorizationRequest) error
+	authorizeMutex       sync.RWMutex
+	authorizeArgsForCall []struct {
+		logger  lager.Logger
+		request authenticators.AuthorizationRequest
+	}
+	authorizeReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeAuthorizationPolicy) Authorize(logger lager.Logger, request authenticators.AuthorizationRequest) error {
+	fake.authorizeMutex.Lock()
+	fake.authorizeArgsForCall = append(fake.authorizeArgsForCall, struct {
+		logger  lager.Logger
+		request authenticators.AuthorizationRequest
+	}{logger, request})
+	fake.recordInvocation("Authorize", []interface{}{logger, request})
+	fake.authorizeMutex.Unlock()
+	if fake.AuthorizeStub != nil {
+		return fake.AuthorizeStub(logger, request)
+	} else {
+		return fake.authorizeReturns.result1
+	}
+}
+
+func (fake *FakeAuthorizationPolicy) AuthorizeCallCount() int {
+	fake.authorizeMutex.RLock()
+	defer fake.authorizeMutex.RUnlock()
+	return len(fake.authorizeArgsForCall)
+}
+
+func (fake *FakeAuthorizationPolicy) AuthorizeArgsForCall(i int) (lager.Logger, authenticators.AuthorizationRequest) {
+	fake.authorizeMutex.RLock()
+	defer fake.authorizeMutex.RUnlock()
+	return fake.authorizeArgsForCall[i].logger, fake.authorizeArgsForCall[i].request
+}
+
+func (fake *FakeAuthorizationPolicy) AuthorizeReturns(result1 error) {
+	fake.AuthorizeStub = nil
+	fake.authorizeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAuthorizationPolicy) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.authorizeMutex.RLock()
+	defer fake.authorizeMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeAuthorizationPolicy) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ authenticators.AuthorizationPolicy = new(FakeAuthorizationPolicy)
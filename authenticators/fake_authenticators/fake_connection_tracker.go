@@ -0,0 +1,112 @@
+// This file was generated by counterfeiter
+package fake_authenticators
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
+)
+
+type FakeConnectionTracker struct {
+	ConnectionsStub        func() []proxy.ConnectionInfo
+	connectionsMutex       sync.RWMutex
+	connectionsArgsForCall []struct{}
+	connectionsReturns     struct {
+		result1 []proxy.ConnectionInfo
+	}
+	CloseAppConnectionsStub        func(appGuid string, message string) int
+	closeAppConnectionsMutex       sync.RWMutex
+	closeAppConnectionsArgsForCall []struct {
+		appGuid string
+		message string
+	}
+	closeAppConnectionsReturns struct {
+		result1 int
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeConnectionTracker) Connections() []proxy.ConnectionInfo {
+	fake.connectionsMutex.Lock()
+	fake.connectionsArgsForCall = append(fake.connectionsArgsForCall, struct{}{})
+	fake.recordInvocation("Connections", []interface{}{})
+	fake.connectionsMutex.Unlock()
+	if fake.ConnectionsStub != nil {
+		return fake.ConnectionsStub()
+	} else {
+		return fake.connectionsReturns.result1
+	}
+}
+
+func (fake *FakeConnectionTracker) ConnectionsCallCount() int {
+	fake.connectionsMutex.RLock()
+	defer fake.connectionsMutex.RUnlock()
+	return len(fake.connectionsArgsForCall)
+}
+
+func (fake *FakeConnectionTracker) ConnectionsReturns(result1 []proxy.ConnectionInfo) {
+	fake.ConnectionsStub = nil
+	fake.connectionsReturns = struct {
+		result1 []proxy.ConnectionInfo
+	}{result1}
+}
+
+func (fake *FakeConnectionTracker) CloseAppConnections(appGuid string, message string) int {
+	fake.closeAppConnectionsMutex.Lock()
+	fake.closeAppConnectionsArgsForCall = append(fake.closeAppConnectionsArgsForCall, struct {
+		appGuid string
+		message string
+	}{appGuid, message})
+	fake.recordInvocation("CloseAppConnections", []interface{}{appGuid, message})
+	fake.closeAppConnectionsMutex.Unlock()
+	if fake.CloseAppConnectionsStub != nil {
+		return fake.CloseAppConnectionsStub(appGuid, message)
+	} else {
+		return fake.closeAppConnectionsReturns.result1
+	}
+}
+
+func (fake *FakeConnectionTracker) CloseAppConnectionsCallCount() int {
+	fake.closeAppConnectionsMutex.RLock()
+	defer fake.closeAppConnectionsMutex.RUnlock()
+	return len(fake.closeAppConnectionsArgsForCall)
+}
+
+func (fake *FakeConnectionTracker) CloseAppConnectionsArgsForCall(i int) (string, string) {
+	fake.closeAppConnectionsMutex.RLock()
+	defer fake.closeAppConnectionsMutex.RUnlock()
+	return fake.closeAppConnectionsArgsForCall[i].appGuid, fake.closeAppConnectionsArgsForCall[i].message
+}
+
+func (fake *FakeConnectionTracker) CloseAppConnectionsReturns(result1 int) {
+	fake.CloseAppConnectionsStub = nil
+	fake.closeAppConnectionsReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeConnectionTracker) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.connectionsMutex.RLock()
+	defer fake.connectionsMutex.RUnlock()
+	fake.closeAppConnectionsMutex.RLock()
+	defer fake.closeAppConnectionsMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeConnectionTracker) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ authenticators.ConnectionTracker = new(FakeConnectionTracker)
@@ -0,0 +1,145 @@
+// This file was generated by counterfeiter
+package fake_authenticators
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"gopkg.in/ldap.v2"
+)
+
+type FakeLDAPConn struct {
+	BindStub        func(username, password string) error
+	bindMutex       sync.RWMutex
+	bindArgsForCall []struct {
+		username string
+		password string
+	}
+	bindReturns struct {
+		result1 error
+	}
+	SearchStub        func(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	searchMutex       sync.RWMutex
+	searchArgsForCall []struct {
+		searchRequest *ldap.SearchRequest
+	}
+	searchReturns struct {
+		result1 *ldap.SearchResult
+		result2 error
+	}
+	CloseStub        func()
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct{}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeLDAPConn) Bind(username string, password string) error {
+	fake.bindMutex.Lock()
+	fake.bindArgsForCall = append(fake.bindArgsForCall, struct {
+		username string
+		password string
+	}{username, password})
+	fake.recordInvocation("Bind", []interface{}{username, password})
+	fake.bindMutex.Unlock()
+	if fake.BindStub != nil {
+		return fake.BindStub(username, password)
+	} else {
+		return fake.bindReturns.result1
+	}
+}
+
+func (fake *FakeLDAPConn) BindCallCount() int {
+	fake.bindMutex.RLock()
+	defer fake.bindMutex.RUnlock()
+	return len(fake.bindArgsForCall)
+}
+
+func (fake *FakeLDAPConn) BindArgsForCall(i int) (string, string) {
+	fake.bindMutex.RLock()
+	defer fake.bindMutex.RUnlock()
+	return fake.bindArgsForCall[i].username, fake.bindArgsForCall[i].password
+}
+
+func (fake *FakeLDAPConn) BindReturns(result1 error) {
+	fake.BindStub = nil
+	fake.bindReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLDAPConn) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	fake.searchMutex.Lock()
+	fake.searchArgsForCall = append(fake.searchArgsForCall, struct {
+		searchRequest *ldap.SearchRequest
+	}{searchRequest})
+	fake.recordInvocation("Search", []interface{}{searchRequest})
+	fake.searchMutex.Unlock()
+	if fake.SearchStub != nil {
+		return fake.SearchStub(searchRequest)
+	} else {
+		return fake.searchReturns.result1, fake.searchReturns.result2
+	}
+}
+
+func (fake *FakeLDAPConn) SearchCallCount() int {
+	fake.searchMutex.RLock()
+	defer fake.searchMutex.RUnlock()
+	return len(fake.searchArgsForCall)
+}
+
+func (fake *FakeLDAPConn) SearchArgsForCall(i int) *ldap.SearchRequest {
+	fake.searchMutex.RLock()
+	defer fake.searchMutex.RUnlock()
+	return fake.searchArgsForCall[i].searchRequest
+}
+
+func (fake *FakeLDAPConn) SearchReturns(result1 *ldap.SearchResult, result2 error) {
+	fake.SearchStub = nil
+	fake.searchReturns = struct {
+		result1 *ldap.SearchResult
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLDAPConn) Close() {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct{}{})
+	fake.recordInvocation("Close", []interface{}{})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		fake.CloseStub()
+	}
+}
+
+func (fake *FakeLDAPConn) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeLDAPConn) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.bindMutex.RLock()
+	defer fake.bindMutex.RUnlock()
+	fake.searchMutex.RLock()
+	defer fake.searchMutex.RUnlock()
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeLDAPConn) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ authenticators.LDAPConn = new(FakeLDAPConn)
@@ -10,6 +10,12 @@ import (
 )
 
 type FakePasswordAuthenticator struct {
+	RealmStub        func() string
+	realmMutex       sync.RWMutex
+	realmArgsForCall []struct{}
+	realmReturns     struct {
+		result1 string
+	}
 	UserRegexpStub        func() *regexp.Regexp
 	userRegexpMutex       sync.RWMutex
 	userRegexpArgsForCall []struct{}
@@ -30,6 +36,31 @@ type FakePasswordAuthenticator struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakePasswordAuthenticator) Realm() string {
+	fake.realmMutex.Lock()
+	fake.realmArgsForCall = append(fake.realmArgsForCall, struct{}{})
+	fake.recordInvocation("Realm", []interface{}{})
+	fake.realmMutex.Unlock()
+	if fake.RealmStub != nil {
+		return fake.RealmStub()
+	} else {
+		return fake.realmReturns.result1
+	}
+}
+
+func (fake *FakePasswordAuthenticator) RealmCallCount() int {
+	fake.realmMutex.RLock()
+	defer fake.realmMutex.RUnlock()
+	return len(fake.realmArgsForCall)
+}
+
+func (fake *FakePasswordAuthenticator) RealmReturns(result1 string) {
+	fake.RealmStub = nil
+	fake.realmReturns = struct {
+		result1 string
+	}{result1}
+}
+
 func (fake *FakePasswordAuthenticator) UserRegexp() *regexp.Regexp {
 	fake.userRegexpMutex.Lock()
 	fake.userRegexpArgsForCall = append(fake.userRegexpArgsForCall, struct{}{})
@@ -98,6 +129,8 @@ func (fake *FakePasswordAuthenticator) AuthenticateReturns(result1 *ssh.Permissi
 func (fake *FakePasswordAuthenticator) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.realmMutex.RLock()
+	defer fake.realmMutex.RUnlock()
 	fake.userRegexpMutex.RLock()
 	defer fake.userRegexpMutex.RUnlock()
 	fake.authenticateMutex.RLock()
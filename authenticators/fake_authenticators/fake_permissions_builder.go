@@ -10,13 +10,15 @@ import (
 )
 
 type FakePermissionsBuilder struct {
-	BuildStub        func(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata) (*ssh.Permissions, error)
+	BuildStub        func(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata, user string, fetchAppMetadata authenticators.AppMetadataFetcher) (*ssh.Permissions, error)
 	buildMutex       sync.RWMutex
 	buildArgsForCall []struct {
-		logger      lager.Logger
-		processGuid string
-		index       int
-		metadata    ssh.ConnMetadata
+		logger           lager.Logger
+		processGuid      string
+		index            int
+		metadata         ssh.ConnMetadata
+		user             string
+		fetchAppMetadata authenticators.AppMetadataFetcher
 	}
 	buildReturns struct {
 		result1 *ssh.Permissions
@@ -26,18 +28,20 @@ type FakePermissionsBuilder struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakePermissionsBuilder) Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata) (*ssh.Permissions, error) {
+func (fake *FakePermissionsBuilder) Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata, user string, fetchAppMetadata authenticators.AppMetadataFetcher) (*ssh.Permissions, error) {
 	fake.buildMutex.Lock()
 	fake.buildArgsForCall = append(fake.buildArgsForCall, struct {
-		logger      lager.Logger
-		processGuid string
-		index       int
-		metadata    ssh.ConnMetadata
-	}{logger, processGuid, index, metadata})
-	fake.recordInvocation("Build", []interface{}{logger, processGuid, index, metadata})
+		logger           lager.Logger
+		processGuid      string
+		index            int
+		metadata         ssh.ConnMetadata
+		user             string
+		fetchAppMetadata authenticators.AppMetadataFetcher
+	}{logger, processGuid, index, metadata, user, fetchAppMetadata})
+	fake.recordInvocation("Build", []interface{}{logger, processGuid, index, metadata, user, fetchAppMetadata})
 	fake.buildMutex.Unlock()
 	if fake.BuildStub != nil {
-		return fake.BuildStub(logger, processGuid, index, metadata)
+		return fake.BuildStub(logger, processGuid, index, metadata, user, fetchAppMetadata)
 	} else {
 		return fake.buildReturns.result1, fake.buildReturns.result2
 	}
@@ -49,10 +53,10 @@ func (fake *FakePermissionsBuilder) BuildCallCount() int {
 	return len(fake.buildArgsForCall)
 }
 
-func (fake *FakePermissionsBuilder) BuildArgsForCall(i int) (lager.Logger, string, int, ssh.ConnMetadata) {
+func (fake *FakePermissionsBuilder) BuildArgsForCall(i int) (lager.Logger, string, int, ssh.ConnMetadata, string, authenticators.AppMetadataFetcher) {
 	fake.buildMutex.RLock()
 	defer fake.buildMutex.RUnlock()
-	return fake.buildArgsForCall[i].logger, fake.buildArgsForCall[i].processGuid, fake.buildArgsForCall[i].index, fake.buildArgsForCall[i].metadata
+	return fake.buildArgsForCall[i].logger, fake.buildArgsForCall[i].processGuid, fake.buildArgsForCall[i].index, fake.buildArgsForCall[i].metadata, fake.buildArgsForCall[i].user, fake.buildArgsForCall[i].fetchAppMetadata
 }
 
 func (fake *FakePermissionsBuilder) BuildReturns(result1 *ssh.Permissions, result2 error) {
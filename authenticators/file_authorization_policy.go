@@ -0,0 +1,192 @@
+package authenticators
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+// PolicyDocument is the JSON representation of the policy enforced by the
+// authorization policy returned from NewFileAuthorizationPolicy.
+type PolicyDocument struct {
+	DenySpaces        []string     `json:"deny_spaces,omitempty"`
+	DenyOrganizations []string     `json:"deny_organizations,omitempty"`
+	AllowedWindows    []TimeWindow `json:"allowed_windows,omitempty"`
+	TimeZone          string       `json:"time_zone,omitempty"`
+}
+
+// TimeWindow describes a daily period, in 24 hour HH:MM notation, during
+// which access is allowed. An empty list of days applies the window to every
+// day of the week. When End is before Start the window spans midnight.
+type TimeWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type timeWindow struct {
+	days  map[time.Weekday]bool
+	start time.Duration
+	end   time.Duration
+}
+
+type filePolicy struct {
+	deniedSpaces        map[string]bool
+	deniedOrganizations map[string]bool
+	allowedWindows      []timeWindow
+	location            *time.Location
+	clock               clock.Clock
+}
+
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		weekdays[name] = d
+		weekdays[name[:3]] = d
+	}
+}
+
+func NewFileAuthorizationPolicy(path string, clock clock.Clock) (AuthorizationPolicy, error) {
+	policyFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer policyFile.Close()
+
+	var document PolicyDocument
+	err = json.NewDecoder(policyFile).Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuthorizationPolicy(document, clock)
+}
+
+func NewAuthorizationPolicy(document PolicyDocument, clock clock.Clock) (AuthorizationPolicy, error) {
+	policy := &filePolicy{
+		deniedSpaces:        map[string]bool{},
+		deniedOrganizations: map[string]bool{},
+		location:            time.UTC,
+		clock:               clock,
+	}
+
+	for _, guid := range document.DenySpaces {
+		policy.deniedSpaces[guid] = true
+	}
+
+	for _, guid := range document.DenyOrganizations {
+		policy.deniedOrganizations[guid] = true
+	}
+
+	if document.TimeZone != "" {
+		location, err := time.LoadLocation(document.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		policy.location = location
+	}
+
+	for _, window := range document.AllowedWindows {
+		w, err := parseTimeWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		policy.allowedWindows = append(policy.allowedWindows, w)
+	}
+
+	return policy, nil
+}
+
+func parseTimeWindow(window TimeWindow) (timeWindow, error) {
+	start, err := parseTimeOfDay(window.Start)
+	if err != nil {
+		return timeWindow{}, err
+	}
+
+	end, err := parseTimeOfDay(window.End)
+	if err != nil {
+		return timeWindow{}, err
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, day := range window.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return timeWindow{}, fmt.Errorf("invalid day in time window: %s", day)
+		}
+		days[weekday] = true
+	}
+
+	return timeWindow{days: days, start: start, end: end}, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day in time window: %s", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (p *filePolicy) Authorize(logger lager.Logger, request AuthorizationRequest) error {
+	logger = logger.Session("file-authorization-policy")
+
+	// The space and organization of a session are not always known. When
+	// deny lists are configured, sessions that cannot be checked against
+	// them are denied rather than allowed.
+	if len(p.deniedSpaces) > 0 {
+		if request.SpaceGuid == "" {
+			logger.Info("space-unknown")
+			return AccessDeniedErr
+		}
+		if p.deniedSpaces[request.SpaceGuid] {
+			logger.Info("space-denied", lager.Data{"space-guid": request.SpaceGuid})
+			return AccessDeniedErr
+		}
+	}
+
+	if len(p.deniedOrganizations) > 0 {
+		if request.OrganizationGuid == "" {
+			logger.Info("organization-unknown")
+			return AccessDeniedErr
+		}
+		if p.deniedOrganizations[request.OrganizationGuid] {
+			logger.Info("organization-denied", lager.Data{"organization-guid": request.OrganizationGuid})
+			return AccessDeniedErr
+		}
+	}
+
+	if len(p.allowedWindows) > 0 && !p.withinAllowedWindow(p.clock.Now().In(p.location)) {
+		logger.Info("outside-allowed-time-windows")
+		return AccessDeniedErr
+	}
+
+	return nil
+}
+
+func (p *filePolicy) withinAllowedWindow(now time.Time) bool {
+	timeOfDay := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	for _, window := range p.allowedWindows {
+		if len(window.days) > 0 && !window.days[now.Weekday()] {
+			continue
+		}
+
+		if window.start <= window.end {
+			if timeOfDay >= window.start && timeOfDay < window.end {
+				return true
+			}
+		} else if timeOfDay >= window.start || timeOfDay < window.end {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,251 @@
+package authenticators_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileAuthorizationPolicy", func() {
+	var (
+		logger    *lagertest.TestLogger
+		fakeClock *fakeclock.FakeClock
+		document  authenticators.PolicyDocument
+		policy    authenticators.AuthorizationPolicy
+		request   authenticators.AuthorizationRequest
+		policyErr error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		// Wednesday
+		fakeClock = fakeclock.NewFakeClock(time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC))
+
+		document = authenticators.PolicyDocument{}
+		request = authenticators.AuthorizationRequest{
+			User:             "cf:app-guid/0",
+			AppGuid:          "app-guid",
+			SpaceGuid:        "space-guid",
+			OrganizationGuid: "org-guid",
+		}
+	})
+
+	Describe("Authorize", func() {
+		var authorizeErr error
+
+		JustBeforeEach(func() {
+			policy, policyErr = authenticators.NewAuthorizationPolicy(document, fakeClock)
+			Expect(policyErr).NotTo(HaveOccurred())
+
+			authorizeErr = policy.Authorize(logger, request)
+		})
+
+		It("allows access by default", func() {
+			Expect(authorizeErr).NotTo(HaveOccurred())
+		})
+
+		Context("when the space is denied", func() {
+			BeforeEach(func() {
+				document.DenySpaces = []string{"space-guid"}
+			})
+
+			It("denies access", func() {
+				Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+			})
+		})
+
+		Context("when the organization is denied", func() {
+			BeforeEach(func() {
+				document.DenyOrganizations = []string{"org-guid"}
+			})
+
+			It("denies access", func() {
+				Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+			})
+		})
+
+		Context("when a different space and organization are denied", func() {
+			BeforeEach(func() {
+				document.DenySpaces = []string{"other-space-guid"}
+				document.DenyOrganizations = []string{"other-org-guid"}
+			})
+
+			It("allows access", func() {
+				Expect(authorizeErr).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the space and organization of the session are unknown", func() {
+			BeforeEach(func() {
+				request.SpaceGuid = ""
+				request.OrganizationGuid = ""
+			})
+
+			It("allows access when nothing is denied", func() {
+				Expect(authorizeErr).NotTo(HaveOccurred())
+			})
+
+			Context("and spaces are denied", func() {
+				BeforeEach(func() {
+					document.DenySpaces = []string{"other-space-guid"}
+				})
+
+				It("denies access", func() {
+					Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+				})
+			})
+
+			Context("and organizations are denied", func() {
+				BeforeEach(func() {
+					document.DenyOrganizations = []string{"other-org-guid"}
+				})
+
+				It("denies access", func() {
+					Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+				})
+			})
+		})
+
+		Context("when time windows are configured", func() {
+			Context("and the current time is within a window", func() {
+				BeforeEach(func() {
+					document.AllowedWindows = []authenticators.TimeWindow{
+						{Days: []string{"Wednesday"}, Start: "09:00", End: "17:00"},
+					}
+				})
+
+				It("allows access", func() {
+					Expect(authorizeErr).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("and the current time is outside of every window", func() {
+				BeforeEach(func() {
+					document.AllowedWindows = []authenticators.TimeWindow{
+						{Start: "13:00", End: "17:00"},
+						{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"},
+					}
+				})
+
+				It("denies access", func() {
+					Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+				})
+			})
+
+			Context("and the window spans midnight", func() {
+				BeforeEach(func() {
+					document.AllowedWindows = []authenticators.TimeWindow{
+						{Start: "22:00", End: "13:00"},
+					}
+				})
+
+				It("allows access", func() {
+					Expect(authorizeErr).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("and a time zone is configured", func() {
+				BeforeEach(func() {
+					document.TimeZone = "America/New_York"
+					document.AllowedWindows = []authenticators.TimeWindow{
+						{Start: "09:00", End: "17:00"},
+					}
+				})
+
+				It("evaluates the window in that time zone", func() {
+					Expect(authorizeErr).To(Equal(authenticators.AccessDeniedErr))
+				})
+			})
+		})
+	})
+
+	Describe("NewAuthorizationPolicy", func() {
+		JustBeforeEach(func() {
+			policy, policyErr = authenticators.NewAuthorizationPolicy(document, fakeClock)
+		})
+
+		Context("when a time window has an invalid day", func() {
+			BeforeEach(func() {
+				document.AllowedWindows = []authenticators.TimeWindow{
+					{Days: []string{"someday"}, Start: "09:00", End: "17:00"},
+				}
+			})
+
+			It("returns an error", func() {
+				Expect(policyErr).To(MatchError(ContainSubstring("invalid day")))
+			})
+		})
+
+		Context("when a time window has an invalid time", func() {
+			BeforeEach(func() {
+				document.AllowedWindows = []authenticators.TimeWindow{
+					{Start: "9am", End: "17:00"},
+				}
+			})
+
+			It("returns an error", func() {
+				Expect(policyErr).To(MatchError(ContainSubstring("invalid time of day")))
+			})
+		})
+
+		Context("when the time zone is invalid", func() {
+			BeforeEach(func() {
+				document.TimeZone = "Nowhere/Special"
+			})
+
+			It("returns an error", func() {
+				Expect(policyErr).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("NewFileAuthorizationPolicy", func() {
+		var policyPath string
+
+		BeforeEach(func() {
+			policyFile, err := ioutil.TempFile("", "authorization-policy")
+			Expect(err).NotTo(HaveOccurred())
+			policyPath = policyFile.Name()
+
+			_, err = policyFile.Write([]byte(`{"deny_spaces": ["space-guid"]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policyFile.Close()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove(policyPath)
+		})
+
+		It("loads the policy from the file", func() {
+			policy, err := authenticators.NewFileAuthorizationPolicy(policyPath, fakeClock)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Authorize(logger, request)).To(Equal(authenticators.AccessDeniedErr))
+		})
+
+		Context("when the file does not exist", func() {
+			It("returns an error", func() {
+				_, err := authenticators.NewFileAuthorizationPolicy("/does/not/exist", fakeClock)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the file is not valid json", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(policyPath, []byte("{{"), 0600)).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				_, err := authenticators.NewFileAuthorizationPolicy(policyPath, fakeClock)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,57 @@
+package authenticators
+
+import (
+	"crypto/subtle"
+	"regexp"
+
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/crypto/ssh"
+)
+
+const HealthCheckRealm = "healthcheck"
+
+// HealthCheckAuthenticator accepts a single configured user so that monitors
+// can exercise the proxy's handshake and authentication without a backend.
+// The permissions it returns mark the connection as a health check; the
+// proxy closes such connections as soon as the handshake completes.
+type HealthCheckAuthenticator struct {
+	logger     lager.Logger
+	secret     []byte
+	userRegexp *regexp.Regexp
+}
+
+func NewHealthCheckAuthenticator(logger lager.Logger, name, secret string) *HealthCheckAuthenticator {
+	return &HealthCheckAuthenticator{
+		logger:     logger,
+		secret:     []byte(secret),
+		userRegexp: regexp.MustCompile("^" + HealthCheckRealm + ":" + regexp.QuoteMeta(name) + "$"),
+	}
+}
+
+func (ha *HealthCheckAuthenticator) Realm() string {
+	return HealthCheckRealm
+}
+
+func (ha *HealthCheckAuthenticator) UserRegexp() *regexp.Regexp {
+	return ha.userRegexp
+}
+
+func (ha *HealthCheckAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	logger := ha.logger.Session("health-check-authenticate")
+
+	if !ha.userRegexp.MatchString(metadata.User()) {
+		logger.Error("regex-match-fail", InvalidUserFormatErr)
+		return nil, InvalidUserFormatErr
+	}
+
+	if len(ha.secret) == 0 || subtle.ConstantTimeCompare(ha.secret, password) != 1 {
+		logger.Error("invalid-credentials", InvalidCredentialsErr)
+		return nil, InvalidCredentialsErr
+	}
+
+	return &ssh.Permissions{
+		CriticalOptions: map[string]string{
+			"health-check": "true",
+		},
+	}, nil
+}
@@ -0,0 +1,81 @@
+package authenticators_test
+
+import (
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HealthCheckAuthenticator", func() {
+	var (
+		authenticator *authenticators.HealthCheckAuthenticator
+		metadata      *fake_ssh.FakeConnMetadata
+		password      []byte
+
+		permissions *ssh.Permissions
+		authErr     error
+	)
+
+	BeforeEach(func() {
+		authenticator = authenticators.NewHealthCheckAuthenticator(lagertest.NewTestLogger("test"), "monitor", "monitor-secret")
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("healthcheck:monitor")
+		password = []byte("monitor-secret")
+	})
+
+	JustBeforeEach(func() {
+		permissions, authErr = authenticator.Authenticate(metadata, password)
+	})
+
+	It("uses the healthcheck realm", func() {
+		Expect(authenticator.Realm()).To(Equal("healthcheck"))
+		Expect(authenticator.UserRegexp().MatchString("healthcheck:monitor")).To(BeTrue())
+		Expect(authenticator.UserRegexp().MatchString("healthcheck:someone-else")).To(BeFalse())
+	})
+
+	It("marks the connection as a health check", func() {
+		Expect(authErr).NotTo(HaveOccurred())
+		Expect(permissions.CriticalOptions).To(Equal(map[string]string{"health-check": "true"}))
+	})
+
+	It("does not provide a proxy target", func() {
+		Expect(authErr).NotTo(HaveOccurred())
+		Expect(permissions.CriticalOptions).NotTo(HaveKey("proxy-target-config"))
+	})
+
+	Context("when the user does not match the configured name", func() {
+		BeforeEach(func() {
+			metadata.UserReturns("healthcheck:someone-else")
+		})
+
+		It("fails with an invalid user format error", func() {
+			Expect(authErr).To(Equal(authenticators.InvalidUserFormatErr))
+		})
+	})
+
+	Context("when the secret is wrong", func() {
+		BeforeEach(func() {
+			password = []byte("guess")
+		})
+
+		It("fails with invalid credentials", func() {
+			Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+		})
+	})
+
+	Context("when no secret is configured", func() {
+		BeforeEach(func() {
+			authenticator = authenticators.NewHealthCheckAuthenticator(lagertest.NewTestLogger("test"), "monitor", "")
+			password = []byte("")
+		})
+
+		It("rejects every password", func() {
+			Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+		})
+	})
+})
@@ -0,0 +1,216 @@
+package authenticators
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+const HtpasswdRealm = "htpasswd"
+
+// HtpasswdAuthenticator authenticates users against an htpasswd file and
+// proxies them to one of a static set of targets. Users have the form
+// htpasswd:<user>/<target>. Passwords must be bcrypt, MD5 ($apr1$), or {SHA}
+// hashes.
+type HtpasswdAuthenticator struct {
+	logger      lager.Logger
+	credentials map[string]string
+	targets     map[string]proxy.TargetConfig
+	userRegexp  *regexp.Regexp
+}
+
+func NewHtpasswdAuthenticator(
+	logger lager.Logger,
+	path string,
+	targets map[string]proxy.TargetConfig,
+) (*HtpasswdAuthenticator, error) {
+	credentials, err := loadHtpasswd(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HtpasswdAuthenticator{
+		logger:      logger,
+		credentials: credentials,
+		targets:     targets,
+		userRegexp:  targetUserRegexp(HtpasswdRealm),
+	}, nil
+}
+
+func loadHtpasswd(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	credentials := map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("malformed htpasswd entry on line %d", line)
+		}
+
+		hash := parts[1]
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("unsupported password hash for user %s: use bcrypt (htpasswd -B), MD5 (htpasswd -m), or SHA1 (htpasswd -s)", parts[0])
+		}
+
+		credentials[parts[0]] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (ha *HtpasswdAuthenticator) Realm() string {
+	return HtpasswdRealm
+}
+
+func (ha *HtpasswdAuthenticator) UserRegexp() *regexp.Regexp {
+	return ha.userRegexp
+}
+
+func (ha *HtpasswdAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	logger := ha.logger.Session("htpasswd-authenticate")
+	logger.Info("authenticate-starting")
+	defer logger.Info("authenticate-finished")
+
+	match := ha.userRegexp.FindStringSubmatch(metadata.User())
+	if match == nil {
+		logger.Error("regex-match-fail", InvalidUserFormatErr)
+		return nil, InvalidUserFormatErr
+	}
+
+	user, target := match[1], match[2]
+
+	hash, ok := ha.credentials[user]
+	if !ok || !verifyHtpasswd(hash, password) {
+		logger.Error("invalid-credentials", InvalidCredentialsErr, lager.Data{"user": user})
+		return nil, InvalidCredentialsErr
+	}
+
+	permissions, err := targetPermissions(ha.targets, target)
+	if err != nil {
+		logger.Error("building-ssh-permissions-failed", err, lager.Data{"target": target})
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func verifyHtpasswd(hash string, password []byte) bool {
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum(password)
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+
+	if strings.HasPrefix(hash, "$apr1$") {
+		parts := strings.SplitN(hash, "$", 4)
+		if len(parts) != 4 {
+			return false
+		}
+		expected := apr1Hash(password, []byte(parts[2]))
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), password) == nil
+}
+
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1Hash computes the Apache variant of the MD5-based crypt(3) hash of the
+// password with the salt, as produced by htpasswd -m.
+func apr1Hash(password, salt []byte) string {
+	const magic = "$apr1$"
+
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alternate := md5.New()
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	alternateSum := alternate.Sum(nil)
+
+	digest := md5.New()
+	digest.Write(password)
+	digest.Write([]byte(magic))
+	digest.Write(salt)
+	for i := len(password); i > 0; i -= md5.Size {
+		if i > md5.Size {
+			digest.Write(alternateSum)
+		} else {
+			digest.Write(alternateSum[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write(password[:1])
+		}
+	}
+	sum := digest.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write(password)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(salt)
+		}
+		if i%7 != 0 {
+			round.Write(password)
+		}
+		if i&1 == 1 {
+			round.Write(sum)
+		} else {
+			round.Write(password)
+		}
+		sum = round.Sum(nil)
+	}
+
+	encoded := []byte{}
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			encoded = append(encoded, apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(sum[0], sum[6], sum[12], 4)
+	encode(sum[1], sum[7], sum[13], 4)
+	encode(sum[2], sum[8], sum[14], 4)
+	encode(sum[3], sum[9], sum[15], 4)
+	encode(sum[4], sum[10], sum[5], 4)
+	encode(0, 0, sum[11], 2)
+
+	return magic + string(salt) + "$" + string(encoded)
+}
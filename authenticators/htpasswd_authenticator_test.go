@@ -0,0 +1,183 @@
+package authenticators_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HtpasswdAuthenticator", func() {
+	var (
+		logger       *lagertest.TestLogger
+		htpasswdPath string
+		contents     string
+		targets      map[string]proxy.TargetConfig
+		metadata     *fake_ssh.FakeConnMetadata
+
+		authenticator *authenticators.HtpasswdAuthenticator
+		newErr        error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("alice-password"), bcrypt.MinCost)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents = "# users\n" +
+			"alice:" + string(hash) + "\n" +
+			// "bob-password"
+			"bob:{SHA}oHryCTyM4ObJvET53dSBiRe/fXQ=\n" +
+			// "carol-password"
+			"carol:$apr1$Ox9rE7sq$FRs8l1wrjeuQI41zy6xPL1\n"
+
+		targets = map[string]proxy.TargetConfig{
+			"web": {Address: "10.0.0.1:2222", User: "vcap", Password: "secret"},
+		}
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("htpasswd:alice/web")
+	})
+
+	JustBeforeEach(func() {
+		htpasswdFile, err := ioutil.TempFile("", "htpasswd")
+		Expect(err).NotTo(HaveOccurred())
+		htpasswdPath = htpasswdFile.Name()
+
+		_, err = htpasswdFile.Write([]byte(contents))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(htpasswdFile.Close()).To(Succeed())
+
+		authenticator, newErr = authenticators.NewHtpasswdAuthenticator(logger, htpasswdPath, targets)
+	})
+
+	AfterEach(func() {
+		os.Remove(htpasswdPath)
+	})
+
+	It("uses the htpasswd realm", func() {
+		Expect(newErr).NotTo(HaveOccurred())
+		Expect(authenticator.Realm()).To(Equal("htpasswd"))
+		Expect(authenticator.UserRegexp().MatchString("htpasswd:alice/web")).To(BeTrue())
+	})
+
+	Describe("Authenticate", func() {
+		var (
+			password    []byte
+			permissions *ssh.Permissions
+			authErr     error
+		)
+
+		BeforeEach(func() {
+			password = []byte("alice-password")
+		})
+
+		JustBeforeEach(func() {
+			Expect(newErr).NotTo(HaveOccurred())
+			permissions, authErr = authenticator.Authenticate(metadata, password)
+		})
+
+		It("returns permissions for the target", func() {
+			Expect(authErr).NotTo(HaveOccurred())
+
+			var targetConfig proxy.TargetConfig
+			err := json.Unmarshal([]byte(permissions.CriticalOptions["proxy-target-config"]), &targetConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targetConfig).To(Equal(targets["web"]))
+		})
+
+		Context("when the password is wrong", func() {
+			BeforeEach(func() {
+				password = []byte("wrong")
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+				Expect(permissions).To(BeNil())
+			})
+		})
+
+		Context("when the user has a sha1 password", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("htpasswd:bob/web")
+				password = []byte("bob-password")
+			})
+
+			It("authenticates the user", func() {
+				Expect(authErr).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the user has an md5 password", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("htpasswd:carol/web")
+				password = []byte("carol-password")
+			})
+
+			It("authenticates the user", func() {
+				Expect(authErr).NotTo(HaveOccurred())
+			})
+
+			Context("and the password is wrong", func() {
+				BeforeEach(func() {
+					password = []byte("bob-password")
+				})
+
+				It("fails the authentication", func() {
+					Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+				})
+			})
+		})
+
+		Context("when the user is unknown", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("htpasswd:dave/web")
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+			})
+		})
+
+		Context("when the target is unknown", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("htpasswd:alice/db")
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.UnknownTargetErr))
+			})
+		})
+	})
+
+	Context("when an entry uses an unsupported hash", func() {
+		BeforeEach(func() {
+			contents = "carol:rl5Yb1zRTcmhs\n"
+		})
+
+		It("returns an error naming the supported hashes", func() {
+			Expect(newErr).To(MatchError(ContainSubstring("unsupported password hash for user carol")))
+			Expect(newErr).To(MatchError(ContainSubstring("htpasswd -B")))
+		})
+	})
+
+	Context("when an entry is malformed", func() {
+		BeforeEach(func() {
+			contents = "carol\n"
+		})
+
+		It("returns an error", func() {
+			Expect(newErr).To(MatchError(ContainSubstring("malformed htpasswd entry on line 1")))
+		})
+	})
+})
@@ -0,0 +1,200 @@
+package authenticators
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/ldap.v2"
+)
+
+const LDAPRealm = "ldap"
+
+//go:generate counterfeiter -o fake_authenticators/fake_ldap_conn.go . LDAPConn
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+type LDAPDialer func() (LDAPConn, error)
+
+// NewLDAPDialer returns a dialer for an ldap:// or ldaps:// URL. Connections
+// to ldap:// URLs are upgraded with StartTLS so that binds are never sent in
+// plaintext.
+func NewLDAPDialer(ldapURL string, tlsConfig *tls.Config) (LDAPDialer, error) {
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		switch u.Scheme {
+		case "ldap":
+			host = net.JoinHostPort(host, "389")
+		case "ldaps":
+			host = net.JoinHostPort(host, "636")
+		}
+	}
+
+	switch u.Scheme {
+	case "ldap":
+		startTLSConfig := &tls.Config{}
+		if tlsConfig != nil {
+			startTLSConfig = tlsConfig.Clone()
+		}
+		if startTLSConfig.ServerName == "" {
+			startTLSConfig.ServerName, _, _ = net.SplitHostPort(host)
+		}
+
+		return func() (LDAPConn, error) {
+			conn, err := ldap.Dial("tcp", host)
+			if err != nil {
+				return nil, err
+			}
+
+			err = conn.StartTLS(startTLSConfig)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+
+			return conn, nil
+		}, nil
+	case "ldaps":
+		return func() (LDAPConn, error) {
+			return ldap.DialTLS("tcp", host, tlsConfig)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme: %s", u.Scheme)
+	}
+}
+
+// LDAPAuthenticator authenticates users against an LDAP directory and proxies
+// them to one of a static set of targets. Users have the form
+// ldap:<user>/<target>. The user's entry is located with the user filter,
+// after binding as the search user when one is configured, and the password
+// is verified by binding as that entry.
+type LDAPAuthenticator struct {
+	logger       lager.Logger
+	dial         LDAPDialer
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	userFilter   string
+	targets      map[string]proxy.TargetConfig
+	userRegexp   *regexp.Regexp
+}
+
+func NewLDAPAuthenticator(
+	logger lager.Logger,
+	dial LDAPDialer,
+	bindDN string,
+	bindPassword string,
+	baseDN string,
+	userFilter string,
+	targets map[string]proxy.TargetConfig,
+) (*LDAPAuthenticator, error) {
+	if strings.Count(userFilter, "%s") != 1 {
+		return nil, fmt.Errorf("ldap user filter must contain exactly one %%s: %s", userFilter)
+	}
+
+	return &LDAPAuthenticator{
+		logger:       logger,
+		dial:         dial,
+		bindDN:       bindDN,
+		bindPassword: bindPassword,
+		baseDN:       baseDN,
+		userFilter:   userFilter,
+		targets:      targets,
+		userRegexp:   targetUserRegexp(LDAPRealm),
+	}, nil
+}
+
+func (la *LDAPAuthenticator) Realm() string {
+	return LDAPRealm
+}
+
+func (la *LDAPAuthenticator) UserRegexp() *regexp.Regexp {
+	return la.userRegexp
+}
+
+func (la *LDAPAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	logger := la.logger.Session("ldap-authenticate")
+	logger.Info("authenticate-starting")
+	defer logger.Info("authenticate-finished")
+
+	match := la.userRegexp.FindStringSubmatch(metadata.User())
+	if match == nil {
+		logger.Error("regex-match-fail", InvalidUserFormatErr)
+		return nil, InvalidUserFormatErr
+	}
+
+	user, target := match[1], match[2]
+
+	// An empty password would result in an unauthenticated bind that most
+	// directories accept.
+	if len(password) == 0 {
+		logger.Error("empty-password", InvalidCredentialsErr)
+		return nil, InvalidCredentialsErr
+	}
+
+	conn, err := la.dial()
+	if err != nil {
+		logger.Error("dial-failed", err)
+		return nil, AuthenticationFailedErr
+	}
+	defer conn.Close()
+
+	if la.bindDN != "" {
+		err = conn.Bind(la.bindDN, la.bindPassword)
+		if err != nil {
+			logger.Error("search-bind-failed", err)
+			return nil, AuthenticationFailedErr
+		}
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		la.baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		0,
+		false,
+		fmt.Sprintf(la.userFilter, ldap.EscapeFilter(user)),
+		[]string{"dn"},
+		nil,
+	)
+
+	result, err := conn.Search(searchRequest)
+	if err != nil {
+		logger.Error("search-failed", err)
+		return nil, AuthenticationFailedErr
+	}
+
+	if len(result.Entries) != 1 {
+		logger.Error("user-not-found", InvalidCredentialsErr, lager.Data{"user": user, "entries": len(result.Entries)})
+		return nil, InvalidCredentialsErr
+	}
+
+	err = conn.Bind(result.Entries[0].DN, string(password))
+	if err != nil {
+		logger.Error("user-bind-failed", err, lager.Data{"user": user})
+		return nil, InvalidCredentialsErr
+	}
+
+	permissions, err := targetPermissions(la.targets, target)
+	if err != nil {
+		logger.Error("building-ssh-permissions-failed", err, lager.Data{"target": target})
+		return nil, err
+	}
+
+	return permissions, nil
+}
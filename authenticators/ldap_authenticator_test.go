@@ -0,0 +1,239 @@
+package authenticators_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/ldap.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LDAPAuthenticator", func() {
+	var (
+		logger        *lagertest.TestLogger
+		conn          *fake_authenticators.FakeLDAPConn
+		dialErr       error
+		targets       map[string]proxy.TargetConfig
+		authenticator *authenticators.LDAPAuthenticator
+		metadata      *fake_ssh.FakeConnMetadata
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		conn = &fake_authenticators.FakeLDAPConn{}
+		conn.SearchReturns(&ldap.SearchResult{
+			Entries: []*ldap.Entry{{DN: "uid=alice,ou=people,dc=example,dc=com"}},
+		}, nil)
+		dialErr = nil
+
+		targets = map[string]proxy.TargetConfig{
+			"web": {Address: "10.0.0.1:2222", User: "vcap", Password: "secret"},
+		}
+
+		dial := func() (authenticators.LDAPConn, error) {
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			return conn, nil
+		}
+
+		var err error
+		authenticator, err = authenticators.NewLDAPAuthenticator(
+			logger,
+			dial,
+			"cn=search,dc=example,dc=com",
+			"search-password",
+			"dc=example,dc=com",
+			"(uid=%s)",
+			targets,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("ldap:alice/web")
+	})
+
+	It("uses the ldap realm", func() {
+		Expect(authenticator.Realm()).To(Equal("ldap"))
+		Expect(authenticator.UserRegexp().MatchString("ldap:alice/web")).To(BeTrue())
+		Expect(authenticator.UserRegexp().MatchString("ldap:alice")).To(BeFalse())
+	})
+
+	Describe("Authenticate", func() {
+		var (
+			password    []byte
+			permissions *ssh.Permissions
+			authErr     error
+		)
+
+		BeforeEach(func() {
+			password = []byte("alice-password")
+		})
+
+		JustBeforeEach(func() {
+			permissions, authErr = authenticator.Authenticate(metadata, password)
+		})
+
+		It("searches for the user as the search user", func() {
+			Expect(conn.BindCallCount()).To(Equal(2))
+			dn, pw := conn.BindArgsForCall(0)
+			Expect(dn).To(Equal("cn=search,dc=example,dc=com"))
+			Expect(pw).To(Equal("search-password"))
+
+			Expect(conn.SearchCallCount()).To(Equal(1))
+			request := conn.SearchArgsForCall(0)
+			Expect(request.BaseDN).To(Equal("dc=example,dc=com"))
+			Expect(request.Filter).To(Equal("(uid=alice)"))
+		})
+
+		It("verifies the password by binding as the user", func() {
+			dn, pw := conn.BindArgsForCall(1)
+			Expect(dn).To(Equal("uid=alice,ou=people,dc=example,dc=com"))
+			Expect(pw).To(Equal("alice-password"))
+		})
+
+		It("returns permissions for the target", func() {
+			Expect(authErr).NotTo(HaveOccurred())
+
+			var targetConfig proxy.TargetConfig
+			err := json.Unmarshal([]byte(permissions.CriticalOptions["proxy-target-config"]), &targetConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targetConfig).To(Equal(targets["web"]))
+		})
+
+		It("closes the connection", func() {
+			Expect(conn.CloseCallCount()).To(Equal(1))
+		})
+
+		Context("when the user name contains filter characters", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("ldap:al*ce/web")
+			})
+
+			It("escapes them in the search filter", func() {
+				Expect(conn.SearchArgsForCall(0).Filter).To(Equal(`(uid=al\2ace)`))
+			})
+		})
+
+		Context("when the password is empty", func() {
+			BeforeEach(func() {
+				password = []byte{}
+			})
+
+			It("fails without contacting the directory", func() {
+				Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+				Expect(conn.BindCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the user cannot be found", func() {
+			BeforeEach(func() {
+				conn.SearchReturns(&ldap.SearchResult{}, nil)
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+				Expect(permissions).To(BeNil())
+			})
+		})
+
+		Context("when the password is wrong", func() {
+			BeforeEach(func() {
+				conn.BindStub = func(dn, pw string) error {
+					if dn == "uid=alice,ou=people,dc=example,dc=com" {
+						return errors.New("invalid credentials")
+					}
+					return nil
+				}
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.InvalidCredentialsErr))
+				Expect(permissions).To(BeNil())
+			})
+		})
+
+		Context("when the directory cannot be reached", func() {
+			BeforeEach(func() {
+				dialErr = errors.New("connection refused")
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.AuthenticationFailedErr))
+			})
+		})
+
+		Context("when the target is unknown", func() {
+			BeforeEach(func() {
+				metadata.UserReturns("ldap:alice/db")
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.UnknownTargetErr))
+			})
+		})
+	})
+
+	Describe("NewLDAPAuthenticator", func() {
+		It("rejects user filters without a place for the user name", func() {
+			_, err := authenticators.NewLDAPAuthenticator(logger, nil, "", "", "dc=example,dc=com", "(uid=alice)", targets)
+			Expect(err).To(MatchError(ContainSubstring("exactly one %s")))
+		})
+
+		It("rejects user filters with more than one place for the user name", func() {
+			_, err := authenticators.NewLDAPAuthenticator(logger, nil, "", "", "dc=example,dc=com", "(|(uid=%s)(mail=%s))", targets)
+			Expect(err).To(MatchError(ContainSubstring("exactly one %s")))
+		})
+	})
+
+	Describe("NewLDAPDialer", func() {
+		It("rejects unsupported schemes", func() {
+			_, err := authenticators.NewLDAPDialer("http://example.com", nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		Context("with an ldap:// URL", func() {
+			var listener net.Listener
+
+			BeforeEach(func() {
+				var err error
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+
+				go func() {
+					defer GinkgoRecover()
+					for {
+						conn, err := listener.Accept()
+						if err != nil {
+							return
+						}
+						conn.Close()
+					}
+				}()
+			})
+
+			AfterEach(func() {
+				listener.Close()
+			})
+
+			It("fails to connect when StartTLS cannot be negotiated", func() {
+				dial, err := authenticators.NewLDAPDialer("ldap://"+listener.Addr().String(), &tls.Config{})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = dial()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
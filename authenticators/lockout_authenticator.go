@@ -0,0 +1,180 @@
+package authenticators
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/runtimeschema/metric"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	authLockouts          = metric.Counter("ssh-auth-lockouts")
+	authLockoutRejections = metric.Counter("ssh-auth-lockout-rejections")
+)
+
+type Authenticator interface {
+	Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error)
+}
+
+// LockoutAuthenticator temporarily bans source addresses and users that fail
+// authentication too many times within a window. Only failures caused by the
+// credentials or user name presented count. A successful authentication clears the
+// failures recorded for the user but not for the source address.
+type LockoutAuthenticator struct {
+	logger        lager.Logger
+	authenticator Authenticator
+	clock         clock.Clock
+	maxFailures   int
+	window        time.Duration
+	banDuration   time.Duration
+
+	lock      sync.Mutex
+	failures  map[string][]time.Time
+	bans      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewLockoutAuthenticator(
+	logger lager.Logger,
+	authenticator Authenticator,
+	clock clock.Clock,
+	maxFailures int,
+	window time.Duration,
+	banDuration time.Duration,
+) *LockoutAuthenticator {
+	return &LockoutAuthenticator{
+		logger:        logger,
+		authenticator: authenticator,
+		clock:         clock,
+		maxFailures:   maxFailures,
+		window:        window,
+		banDuration:   banDuration,
+		failures:      map[string][]time.Time{},
+		bans:          map[string]time.Time{},
+		lastSweep:     clock.Now(),
+	}
+}
+
+func (la *LockoutAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	logger := la.logger.Session("lockout-authenticate", lager.Data{"user": metadata.User()})
+
+	userKey := "user:" + metadata.User()
+	keys := []string{userKey}
+	if ip := sourceIP(metadata.RemoteAddr()); ip != nil {
+		keys = append(keys, "ip:"+ip.String())
+	}
+
+	if la.banned(keys) {
+		logger.Info("rejected-locked-out")
+		err := authLockoutRejections.Increment()
+		if err != nil {
+			logger.Error("failed-to-send-ssh-auth-lockout-rejections-metric", err)
+		}
+		return nil, LockedOutErr
+	}
+
+	permissions, err := la.authenticator.Authenticate(metadata, password)
+	if err != nil {
+		if isCredentialFailure(err) {
+			la.recordFailure(logger, keys)
+		}
+		return nil, err
+	}
+
+	la.lock.Lock()
+	delete(la.failures, userKey)
+	la.lock.Unlock()
+
+	return permissions, nil
+}
+
+func (la *LockoutAuthenticator) banned(keys []string) bool {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+
+	now := la.clock.Now()
+	banned := false
+	for _, key := range keys {
+		until, ok := la.bans[key]
+		if !ok {
+			continue
+		}
+		if now.Before(until) {
+			banned = true
+		} else {
+			delete(la.bans, key)
+		}
+	}
+
+	return banned
+}
+
+func (la *LockoutAuthenticator) recordFailure(logger lager.Logger, keys []string) {
+	la.lock.Lock()
+	defer la.lock.Unlock()
+
+	now := la.clock.Now()
+	if now.Sub(la.lastSweep) > la.window {
+		la.sweep(now)
+	}
+
+	for _, key := range keys {
+		failures := append(la.recentFailures(key, now), now)
+		if len(failures) < la.maxFailures {
+			la.failures[key] = failures
+			continue
+		}
+
+		delete(la.failures, key)
+		la.bans[key] = now.Add(la.banDuration)
+
+		logger.Info("locked-out", lager.Data{"key": key, "failures": len(failures), "until": la.bans[key]})
+		err := authLockouts.Increment()
+		if err != nil {
+			logger.Error("failed-to-send-ssh-auth-lockouts-metric", err)
+		}
+	}
+}
+
+// isCredentialFailure reports whether err was caused by the credentials the
+// client presented rather than by a backend that could not be reached.
+func isCredentialFailure(err error) bool {
+	switch err {
+	case InvalidCredentialsErr,
+		InvalidUserFormatErr,
+		InvalidDomainErr,
+		ExpiredCredentialsErr,
+		AccessTokenNotAllowedErr:
+		return true
+	}
+	return false
+}
+
+func (la *LockoutAuthenticator) recentFailures(key string, now time.Time) []time.Time {
+	failures := la.failures[key]
+	for len(failures) > 0 && now.Sub(failures[0]) >= la.window {
+		failures = failures[1:]
+	}
+	return failures
+}
+
+func (la *LockoutAuthenticator) sweep(now time.Time) {
+	for key := range la.failures {
+		if failures := la.recentFailures(key, now); len(failures) > 0 {
+			la.failures[key] = failures
+		} else {
+			delete(la.failures, key)
+		}
+	}
+
+	for key, until := range la.bans {
+		if !now.Before(until) {
+			delete(la.bans, key)
+		}
+	}
+
+	la.lastSweep = now
+}
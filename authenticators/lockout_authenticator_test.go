@@ -0,0 +1,197 @@
+package authenticators_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("LockoutAuthenticator", func() {
+	var (
+		logger        *lagertest.TestLogger
+		fakeClock     *fakeclock.FakeClock
+		sender        *fake.FakeMetricSender
+		wrapped       *fake_authenticators.FakePasswordAuthenticator
+		metadata      *fake_ssh.FakeConnMetadata
+		authenticator *authenticators.LockoutAuthenticator
+		permissions   *ssh.Permissions
+	)
+
+	failAuthentications := func(count int) {
+		for i := 0; i < count; i++ {
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(HaveOccurred())
+		}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+
+		sender = fake.NewFakeMetricSender()
+		metrics.Initialize(sender, nil)
+
+		permissions = &ssh.Permissions{}
+		wrapped = &fake_authenticators.FakePasswordAuthenticator{}
+		wrapped.AuthenticateReturns(nil, authenticators.InvalidCredentialsErr)
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("cf:app-guid/0")
+		metadata.RemoteAddrReturns(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678})
+
+		authenticator = authenticators.NewLockoutAuthenticator(logger, wrapped, fakeClock, 3, time.Minute, 10*time.Minute)
+	})
+
+	It("returns the result of the wrapped authenticator", func() {
+		wrapped.AuthenticateReturns(permissions, nil)
+
+		perms, err := authenticator.Authenticate(metadata, []byte("password"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(perms).To(Equal(permissions))
+	})
+
+	Context("when the maximum number of failures is reached", func() {
+		BeforeEach(func() {
+			failAuthentications(3)
+		})
+
+		It("rejects further attempts without consulting the wrapped authenticator", func() {
+			wrapped.AuthenticateReturns(permissions, nil)
+
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.LockedOutErr))
+			Expect(wrapped.AuthenticateCallCount()).To(Equal(3))
+		})
+
+		It("logs and counts the lockout", func() {
+			Expect(logger).To(gbytes.Say("locked-out.*user:cf:app-guid/0"))
+			Expect(sender.GetCounter("ssh-auth-lockouts")).To(BeEquivalentTo(2))
+		})
+
+		It("counts rejected attempts", func() {
+			authenticator.Authenticate(metadata, []byte("password"))
+			Expect(sender.GetCounter("ssh-auth-lockout-rejections")).To(BeEquivalentTo(1))
+		})
+
+		It("bans the source address for other users", func() {
+			metadata.UserReturns("cf:other-app-guid/0")
+
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.LockedOutErr))
+		})
+
+		It("bans the user from other source addresses", func() {
+			metadata.RemoteAddrReturns(&net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 5678})
+
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.LockedOutErr))
+		})
+
+		Context("and the ban has expired", func() {
+			BeforeEach(func() {
+				fakeClock.Increment(10 * time.Minute)
+				wrapped.AuthenticateReturns(permissions, nil)
+			})
+
+			It("allows authentication again", func() {
+				perms, err := authenticator.Authenticate(metadata, []byte("password"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(perms).To(Equal(permissions))
+			})
+		})
+	})
+
+	Context("when the wrapped authenticator fails for reasons other than the credentials", func() {
+		BeforeEach(func() {
+			wrapped.AuthenticateReturns(nil, authenticators.FetchAppFailedErr)
+			failAuthentications(3)
+		})
+
+		It("does not lock out", func() {
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.FetchAppFailedErr))
+			Expect(sender.GetCounter("ssh-auth-lockouts")).To(BeEquivalentTo(0))
+		})
+	})
+
+	Context("when the failures are spread beyond the window", func() {
+		BeforeEach(func() {
+			failAuthentications(2)
+			fakeClock.Increment(time.Minute)
+			failAuthentications(1)
+		})
+
+		It("does not lock out", func() {
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.InvalidCredentialsErr))
+		})
+	})
+
+	Context("when the user authenticates successfully", func() {
+		BeforeEach(func() {
+			failAuthentications(2)
+			metadata.RemoteAddrReturns(&net.TCPAddr{IP: net.ParseIP("5.6.7.8"), Port: 5678})
+
+			wrapped.AuthenticateReturns(permissions, nil)
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).NotTo(HaveOccurred())
+
+			wrapped.AuthenticateReturns(nil, authenticators.InvalidCredentialsErr)
+		})
+
+		It("clears the failures recorded for the user", func() {
+			failAuthentications(2)
+
+			_, err := authenticator.Authenticate(metadata, []byte("password"))
+			Expect(err).To(Equal(authenticators.InvalidCredentialsErr))
+		})
+	})
+
+	Context("when wrapping the cf authenticator", func() {
+		var fakeUAA *ghttp.Server
+
+		BeforeEach(func() {
+			fakeUAA = ghttp.NewServer()
+			fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.RespondWith(http.StatusUnauthorized, `{"error":"invalid_grant"}`))
+
+			cfAuthenticator := authenticators.NewCFAuthenticator(
+				logger,
+				&http.Client{Timeout: time.Second},
+				"http://cloud-controller.example.com",
+				fakeUAA.URL()+"/oauth/token",
+				"diego-ssh",
+				"diego-ssh-secret",
+				&fake_authenticators.FakePermissionsBuilder{},
+			)
+			authenticator = authenticators.NewLockoutAuthenticator(logger, cfAuthenticator, fakeClock, 3, time.Minute, 10*time.Minute)
+
+			metadata.UserReturns("cf:1e051b88-a210-40b7-bcca-df645b24b634/0")
+		})
+
+		AfterEach(func() {
+			fakeUAA.Close()
+		})
+
+		It("locks out clients that present bad one-time codes", func() {
+			failAuthentications(3)
+
+			_, err := authenticator.Authenticate(metadata, []byte("bad-code"))
+			Expect(err).To(Equal(authenticators.LockedOutErr))
+			Expect(fakeUAA.ReceivedRequests()).To(HaveLen(3))
+		})
+	})
+})
@@ -20,7 +20,7 @@ func NewPermissionsBuilder(bbsClient bbs.InternalClient) PermissionsBuilder {
 	return &permissionsBuilder{bbsClient}
 }
 
-func (pb *permissionsBuilder) Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata) (*ssh.Permissions, error) {
+func (pb *permissionsBuilder) Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata, user string, fetchAppMetadata AppMetadataFetcher) (*ssh.Permissions, error) {
 	actual, err := pb.bbsClient.ActualLRPGroupByProcessGuidAndIndex(logger, processGuid, index)
 	if err != nil {
 		return nil, err
@@ -36,18 +36,60 @@ func (pb *permissionsBuilder) Build(logger lager.Logger, processGuid string, ind
 		return nil, err
 	}
 
-	logMessage := fmt.Sprintf("Successful remote access by %s", metadata.RemoteAddr().String())
+	logMessage := fmt.Sprintf("SSH session opened by %s on instance %d from %s", user, index, metadata.RemoteAddr().String())
+
+	appMetadata := appMetadataFromTags(desired)
+	if fetchAppMetadata != nil && (appMetadata == nil || appMetadata.SpaceGuid == "" || appMetadata.OrganizationGuid == "") {
+		fetched, err := fetchAppMetadata(logger)
+		if err != nil {
+			logger.Error("fetching-app-metadata-failed", err)
+		} else {
+			appMetadata = fetched
+		}
+	}
 
 	actualLRP, _ := actual.Resolve()
-	return createPermissions(sshRoute, actualLRP, desired.LogGuid, logMessage, index)
+	return createPermissions(sshRoute, actualLRP, desired.LogGuid, user, logMessage, index, appMetadata)
+}
+
+// appMetadataFromTags builds application metadata from the metric tags that
+// Cloud Foundry attaches to the LRPs it desires, falling back to the app guid
+// embedded in the process guid. It returns nil when the LRP does not identify
+// an application.
+func appMetadataFromTags(desired *models.DesiredLRP) *proxy.AppMetadata {
+	tag := func(name string) string {
+		if value := desired.MetricTags[name]; value != nil {
+			return value.Static
+		}
+		return ""
+	}
+
+	appGuid := tag("app_id")
+	if appGuid == "" {
+		appGuid = appGuidFromProcessGuid(desired.ProcessGuid)
+	}
+	if appGuid == "" {
+		return nil
+	}
+
+	return &proxy.AppMetadata{
+		AppGuid:          appGuid,
+		AppName:          tag("app_name"),
+		SpaceGuid:        tag("space_id"),
+		SpaceName:        tag("space_name"),
+		OrganizationGuid: tag("organization_id"),
+		OrganizationName: tag("organization_name"),
+	}
 }
 
 func createPermissions(
 	sshRoute *routes.SSHRoute,
 	actual *models.ActualLRP,
 	logGuid string,
+	user string,
 	logMessage string,
 	index int,
+	appMetadata *proxy.AppMetadata,
 ) (*ssh.Permissions, error) {
 	var targetConfig *proxy.TargetConfig
 
@@ -75,6 +117,7 @@ func createPermissions(
 
 	logMessageJson, err := json.Marshal(proxy.LogMessage{
 		Guid:    logGuid,
+		User:    user,
 		Message: logMessage,
 		Index:   index,
 	})
@@ -82,11 +125,21 @@ func createPermissions(
 		return nil, err
 	}
 
+	criticalOptions := map[string]string{
+		"proxy-target-config": string(targetConfigJson),
+		"log-message":         string(logMessageJson),
+	}
+
+	if appMetadata != nil {
+		appMetadataJson, err := json.Marshal(appMetadata)
+		if err != nil {
+			return nil, err
+		}
+		criticalOptions["app-metadata"] = string(appMetadataJson)
+	}
+
 	return &ssh.Permissions{
-		CriticalOptions: map[string]string{
-			"proxy-target-config": string(targetConfigJson),
-			"log-message":         string(logMessageJson),
-		},
+		CriticalOptions: criticalOptions,
 	}, nil
 }
 
@@ -108,3 +161,12 @@ func getRoutingInfo(desired *models.DesiredLRP) (*routes.SSHRoute, error) {
 
 	return &sshRoute, nil
 }
+
+// appGuidFromProcessGuid extracts the app guid from a Cloud Foundry process
+// guid, which is the app guid followed by a dash and the app version.
+func appGuidFromProcessGuid(processGuid string) string {
+	if len(processGuid) > 36 && processGuid[36] == '-' {
+		return processGuid[:36]
+	}
+	return ""
+}
@@ -2,13 +2,16 @@ package authenticators_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
 
 	"code.cloudfoundry.org/bbs/fake_bbs"
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/diego-ssh/routes"
 	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"golang.org/x/crypto/ssh"
 
@@ -31,6 +34,10 @@ var _ = Describe("PermissionsBuilder", func() {
 			buildErr           error
 			processGuid        string
 			index              int
+			fetchAppMetadata   authenticators.AppMetadataFetcher
+			fetchCallCount     int
+			fetchedMetadata    *proxy.AppMetadata
+			fetchErr           error
 		)
 
 		BeforeEach(func() {
@@ -76,13 +83,25 @@ var _ = Describe("PermissionsBuilder", func() {
 			Expect(err).NotTo(HaveOccurred())
 			metadata = &fake_ssh.FakeConnMetadata{}
 			metadata.RemoteAddrReturns(remoteAddr)
+			metadata.UserReturns("cf:some-guid/1")
 
 			processGuid = "some-guid"
 			index = 1
+			fetchAppMetadata = nil
+			fetchCallCount = 0
+			fetchedMetadata = &proxy.AppMetadata{
+				AppGuid:          "app-guid",
+				AppName:          "app-name",
+				SpaceGuid:        "space-guid",
+				SpaceName:        "space-name",
+				OrganizationGuid: "org-guid",
+				OrganizationName: "org-name",
+			}
+			fetchErr = nil
 		})
 
 		JustBeforeEach(func() {
-			permissions, buildErr = permissionsBuilder.Build(logger, processGuid, index, metadata)
+			permissions, buildErr = permissionsBuilder.Build(logger, processGuid, index, metadata, "some-user", fetchAppMetadata)
 		})
 
 		It("gets information about the desired lrp referenced in the username", func() {
@@ -116,7 +135,8 @@ var _ = Describe("PermissionsBuilder", func() {
 		It("saves log message information in the critical options of the permissions", func() {
 			expectedConfig := `{
 				"guid": "log-guid",
-				"message": "Successful remote access by 1.1.1.1",
+				"user": "some-user",
+				"message": "SSH session opened by some-user on instance 1 from 1.1.1.1",
 				"index": 1
 			}`
 
@@ -125,6 +145,117 @@ var _ = Describe("PermissionsBuilder", func() {
 			Expect(permissions.CriticalOptions["log-message"]).To(MatchJSON(expectedConfig))
 		})
 
+		It("does not save app metadata when none is provided", func() {
+			Expect(permissions.CriticalOptions).NotTo(HaveKey("app-metadata"))
+		})
+
+		Context("when an app metadata fetcher is provided", func() {
+			BeforeEach(func() {
+				fetchAppMetadata = func(lager.Logger) (*proxy.AppMetadata, error) {
+					fetchCallCount++
+					return fetchedMetadata, fetchErr
+				}
+			})
+
+			It("saves the fetched app metadata in the critical options of the permissions", func() {
+				expectedMetadata := `{
+					"app_guid": "app-guid",
+					"app_name": "app-name",
+					"space_guid": "space-guid",
+					"space_name": "space-name",
+					"organization_guid": "org-guid",
+					"organization_name": "org-name"
+				}`
+
+				Expect(fetchCallCount).To(Equal(1))
+				Expect(permissions.CriticalOptions["app-metadata"]).To(MatchJSON(expectedMetadata))
+			})
+
+			Context("and fetching the app metadata fails", func() {
+				BeforeEach(func() {
+					desiredLRP.ProcessGuid = "1e051b88-a210-40b7-bcca-df645b24b634-some-version"
+					fetchErr = errors.New("boom")
+					fetchedMetadata = nil
+				})
+
+				It("falls back to the app guid of the process guid", func() {
+					Expect(buildErr).NotTo(HaveOccurred())
+					Expect(permissions.CriticalOptions["app-metadata"]).To(MatchJSON(`{
+						"app_guid": "1e051b88-a210-40b7-bcca-df645b24b634",
+						"app_name": "",
+						"space_guid": "",
+						"space_name": "",
+						"organization_guid": "",
+						"organization_name": ""
+					}`))
+				})
+			})
+		})
+
+		Context("when the process guid belongs to a Cloud Foundry application", func() {
+			BeforeEach(func() {
+				desiredLRP.ProcessGuid = "1e051b88-a210-40b7-bcca-df645b24b634-some-version"
+			})
+
+			It("saves the app guid in the critical options of the permissions", func() {
+				Expect(permissions.CriticalOptions["app-metadata"]).To(MatchJSON(`{
+					"app_guid": "1e051b88-a210-40b7-bcca-df645b24b634",
+					"app_name": "",
+					"space_guid": "",
+					"space_name": "",
+					"organization_guid": "",
+					"organization_name": ""
+				}`))
+			})
+		})
+
+		Context("when the desired LRP is tagged with application metadata", func() {
+			BeforeEach(func() {
+				desiredLRP.MetricTags = map[string]*models.MetricTagValue{
+					"app_id":            {Static: "tagged-app-guid"},
+					"app_name":          {Static: "tagged-app-name"},
+					"space_id":          {Static: "tagged-space-guid"},
+					"space_name":        {Static: "tagged-space-name"},
+					"organization_id":   {Static: "tagged-org-guid"},
+					"organization_name": {Static: "tagged-org-name"},
+				}
+			})
+
+			It("saves the tagged app metadata in the critical options of the permissions", func() {
+				expectedMetadata := `{
+					"app_guid": "tagged-app-guid",
+					"app_name": "tagged-app-name",
+					"space_guid": "tagged-space-guid",
+					"space_name": "tagged-space-name",
+					"organization_guid": "tagged-org-guid",
+					"organization_name": "tagged-org-name"
+				}`
+
+				Expect(permissions.CriticalOptions["app-metadata"]).To(MatchJSON(expectedMetadata))
+			})
+
+			Context("and an app metadata fetcher is provided", func() {
+				BeforeEach(func() {
+					fetchAppMetadata = func(lager.Logger) (*proxy.AppMetadata, error) {
+						fetchCallCount++
+						return fetchedMetadata, fetchErr
+					}
+				})
+
+				It("prefers the tags and does not fetch the app metadata", func() {
+					Expect(fetchCallCount).To(Equal(0))
+					Expect(permissions.CriticalOptions["app-metadata"]).To(MatchJSON(`{
+						"app_guid": "tagged-app-guid",
+						"app_name": "tagged-app-name",
+						"space_guid": "tagged-space-guid",
+						"space_name": "tagged-space-name",
+						"organization_guid": "tagged-org-guid",
+						"organization_name": "tagged-org-name"
+					}`))
+				})
+			})
+		})
+
 		Context("when getting the desired LRP information fails", func() {
 			BeforeEach(func() {
 				bbsClient.DesiredLRPByProcessGuidReturns(nil, &models.Error{})
@@ -0,0 +1,95 @@
+package authenticators
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/crypto/ssh"
+)
+
+// PolicyAuthenticator consults an AuthorizationPolicy after the wrapped
+// authenticator has successfully authenticated a user.
+type PolicyAuthenticator struct {
+	logger        lager.Logger
+	authenticator PasswordAuthenticator
+	policy        AuthorizationPolicy
+}
+
+func NewPolicyAuthenticator(
+	logger lager.Logger,
+	authenticator PasswordAuthenticator,
+	policy AuthorizationPolicy,
+) *PolicyAuthenticator {
+	return &PolicyAuthenticator{
+		logger:        logger,
+		authenticator: authenticator,
+		policy:        policy,
+	}
+}
+
+func (pa *PolicyAuthenticator) Realm() string {
+	return pa.authenticator.Realm()
+}
+
+func (pa *PolicyAuthenticator) UserRegexp() *regexp.Regexp {
+	return pa.authenticator.UserRegexp()
+}
+
+func (pa *PolicyAuthenticator) Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	logger := pa.logger.Session("policy-authenticate", lager.Data{"user": metadata.User()})
+
+	permissions, err := pa.authenticator.Authenticate(metadata, password)
+	if err != nil {
+		return nil, err
+	}
+
+	request := AuthorizationRequest{
+		User:     metadata.User(),
+		SourceIP: sourceIP(metadata.RemoteAddr()),
+	}
+
+	if permissions != nil {
+		if appMetadataJson := permissions.CriticalOptions["app-metadata"]; appMetadataJson != "" {
+			var appMetadata proxy.AppMetadata
+			err := json.Unmarshal([]byte(appMetadataJson), &appMetadata)
+			if err != nil {
+				logger.Error("json-unmarshal-failed", err)
+				return nil, err
+			}
+
+			request.AppGuid = appMetadata.AppGuid
+			request.SpaceGuid = appMetadata.SpaceGuid
+			request.OrganizationGuid = appMetadata.OrganizationGuid
+		}
+	}
+
+	err = pa.policy.Authorize(logger, request)
+	if err != nil {
+		logger.Error("authorization-denied", err)
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func sourceIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return net.ParseIP(addr.String())
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,139 @@
+package authenticators_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PolicyAuthenticator", func() {
+	var (
+		logger        *lagertest.TestLogger
+		wrapped       *fake_authenticators.FakePasswordAuthenticator
+		policy        *fake_authenticators.FakeAuthorizationPolicy
+		metadata      *fake_ssh.FakeConnMetadata
+		authenticator *authenticators.PolicyAuthenticator
+		permissions   *ssh.Permissions
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		appMetadataJson, err := json.Marshal(proxy.AppMetadata{
+			AppGuid:          "app-guid",
+			SpaceGuid:        "space-guid",
+			OrganizationGuid: "org-guid",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		permissions = &ssh.Permissions{
+			CriticalOptions: map[string]string{
+				"app-metadata": string(appMetadataJson),
+			},
+		}
+
+		wrapped = &fake_authenticators.FakePasswordAuthenticator{}
+		wrapped.RealmReturns("cf")
+		wrapped.UserRegexpReturns(regexp.MustCompile("cf:.*"))
+		wrapped.AuthenticateReturns(permissions, nil)
+
+		policy = &fake_authenticators.FakeAuthorizationPolicy{}
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("cf:app-guid/0")
+		metadata.RemoteAddrReturns(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678})
+
+		authenticator = authenticators.NewPolicyAuthenticator(logger, wrapped, policy)
+	})
+
+	It("delegates the realm and user regexp to the wrapped authenticator", func() {
+		Expect(authenticator.Realm()).To(Equal("cf"))
+		Expect(authenticator.UserRegexp().String()).To(Equal("cf:.*"))
+	})
+
+	Describe("Authenticate", func() {
+		var (
+			perms   *ssh.Permissions
+			authErr error
+		)
+
+		JustBeforeEach(func() {
+			perms, authErr = authenticator.Authenticate(metadata, []byte("password"))
+		})
+
+		It("authenticates with the wrapped authenticator", func() {
+			Expect(wrapped.AuthenticateCallCount()).To(Equal(1))
+			m, p := wrapped.AuthenticateArgsForCall(0)
+			Expect(m).To(Equal(metadata))
+			Expect(p).To(Equal([]byte("password")))
+		})
+
+		It("consults the policy with the session details", func() {
+			Expect(policy.AuthorizeCallCount()).To(Equal(1))
+			_, request := policy.AuthorizeArgsForCall(0)
+			Expect(request.User).To(Equal("cf:app-guid/0"))
+			Expect(request.AppGuid).To(Equal("app-guid"))
+			Expect(request.SpaceGuid).To(Equal("space-guid"))
+			Expect(request.OrganizationGuid).To(Equal("org-guid"))
+			Expect(request.SourceIP.String()).To(Equal("1.2.3.4"))
+		})
+
+		It("returns the permissions from the wrapped authenticator", func() {
+			Expect(authErr).NotTo(HaveOccurred())
+			Expect(perms).To(Equal(permissions))
+		})
+
+		Context("when the policy denies the session", func() {
+			BeforeEach(func() {
+				policy.AuthorizeReturns(authenticators.AccessDeniedErr)
+			})
+
+			It("fails the authentication", func() {
+				Expect(authErr).To(Equal(authenticators.AccessDeniedErr))
+				Expect(perms).To(BeNil())
+			})
+		})
+
+		Context("when the permissions do not contain app metadata", func() {
+			BeforeEach(func() {
+				wrapped.AuthenticateReturns(&ssh.Permissions{CriticalOptions: map[string]string{}}, nil)
+
+				filePolicy, err := authenticators.NewAuthorizationPolicy(authenticators.PolicyDocument{
+					DenySpaces: []string{"denied-space-guid"},
+				}, fakeclock.NewFakeClock(time.Now()))
+				Expect(err).NotTo(HaveOccurred())
+
+				authenticator = authenticators.NewPolicyAuthenticator(logger, wrapped, filePolicy)
+			})
+
+			It("denies the session when spaces are denied", func() {
+				Expect(authErr).To(Equal(authenticators.AccessDeniedErr))
+				Expect(perms).To(BeNil())
+			})
+		})
+
+		Context("when the wrapped authenticator fails", func() {
+			BeforeEach(func() {
+				wrapped.AuthenticateReturns(nil, errors.New("boom"))
+			})
+
+			It("fails without consulting the policy", func() {
+				Expect(authErr).To(MatchError("boom"))
+				Expect(policy.AuthorizeCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
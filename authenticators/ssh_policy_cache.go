@@ -0,0 +1,306 @@
+package authenticators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+var errAppNotFound = errors.New("app not found")
+
+type sshEnabledResponse struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// SSHPolicyCache remembers applications for which the Cloud Controller
+// reports that SSH is disabled, whether by the app's enable_ssh setting, its
+// space's allow_ssh setting, or globally. It is an AuthorizationPolicy so
+// that new connections to those applications are refused without waiting
+// for the Cloud Controller.
+type SSHPolicyCache struct {
+	logger      lager.Logger
+	httpClient  *http.Client
+	ccURL       string
+	uaaTokenURL string
+	uaaUsername string
+	uaaPassword string
+
+	lock     sync.Mutex
+	disabled map[string]string
+}
+
+func NewSSHPolicyCache(
+	logger lager.Logger,
+	httpClient *http.Client,
+	ccURL string,
+	uaaTokenURL string,
+	uaaUsername string,
+	uaaPassword string,
+) *SSHPolicyCache {
+	return &SSHPolicyCache{
+		logger:      logger.Session("ssh-policy-cache"),
+		httpClient:  httpClient,
+		ccURL:       strings.TrimRight(ccURL, "/"),
+		uaaTokenURL: uaaTokenURL,
+		uaaUsername: uaaUsername,
+		uaaPassword: uaaPassword,
+		disabled:    map[string]string{},
+	}
+}
+
+// VerifyCredentials fetches a client credentials token from the UAA so that a
+// client that lacks the client_credentials grant is reported when the proxy
+// starts rather than on every refresh.
+func (c *SSHPolicyCache) VerifyCredentials(logger lager.Logger) error {
+	logger = logger.Session("verify-credentials")
+
+	_, err := c.fetchToken(logger)
+	if err != nil {
+		logger.Error("fetch-token-failed", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *SSHPolicyCache) Authorize(logger lager.Logger, request AuthorizationRequest) error {
+	if request.AppGuid == "" {
+		return nil
+	}
+
+	c.lock.Lock()
+	reason, disabled := c.disabled[request.AppGuid]
+	c.lock.Unlock()
+
+	if disabled {
+		logger.Info("ssh-disabled-for-app", lager.Data{"app-guid": request.AppGuid, "reason": reason})
+		return SSHDisabledErr
+	}
+
+	return nil
+}
+
+// Refresh asks the Cloud Controller whether SSH is enabled for each of the
+// applications and returns the applications that are disabled along with the
+// reason given by the Cloud Controller. Applications that cannot be checked
+// keep their previous state. Disabled applications that are no longer being
+// refreshed are forgotten; the Cloud Controller checks them again when a new
+// session starts.
+func (c *SSHPolicyCache) Refresh(logger lager.Logger, appGuids []string) map[string]string {
+	logger = logger.Session("refresh")
+
+	guids := map[string]bool{}
+	for _, appGuid := range appGuids {
+		guids[appGuid] = true
+	}
+
+	c.lock.Lock()
+	for appGuid := range c.disabled {
+		if !guids[appGuid] {
+			delete(c.disabled, appGuid)
+		}
+	}
+	c.lock.Unlock()
+
+	if len(guids) > 0 {
+		token, err := c.fetchToken(logger)
+		if err != nil {
+			logger.Error("fetch-token-failed", err)
+		} else {
+			for appGuid := range guids {
+				c.refreshApp(logger, token, appGuid)
+			}
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	disabled := make(map[string]string, len(c.disabled))
+	for appGuid, reason := range c.disabled {
+		disabled[appGuid] = reason
+	}
+	return disabled
+}
+
+func (c *SSHPolicyCache) refreshApp(logger lager.Logger, token string, appGuid string) {
+	response, err := c.fetchSSHEnabled(token, appGuid)
+	if err == errAppNotFound {
+		logger.Info("app-not-found", lager.Data{"app-guid": appGuid})
+		c.lock.Lock()
+		delete(c.disabled, appGuid)
+		c.lock.Unlock()
+		return
+	}
+	if err != nil {
+		logger.Error("fetch-ssh-enabled-failed", err, lager.Data{"app-guid": appGuid})
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if response.Enabled {
+		delete(c.disabled, appGuid)
+		return
+	}
+
+	if _, ok := c.disabled[appGuid]; !ok {
+		logger.Info("ssh-disabled-for-app", lager.Data{"app-guid": appGuid, "reason": response.Reason})
+	}
+	c.disabled[appGuid] = response.Reason
+}
+
+func (c *SSHPolicyCache) fetchSSHEnabled(token string, appGuid string) (*sshEnabledResponse, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v3/apps/%s/ssh_enabled", c.ccURL, appGuid), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errAppNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cloud controller responded with status %d", resp.StatusCode)
+	}
+
+	var response sshEnabledResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, InvalidCCResponse
+	}
+
+	return &response, nil
+}
+
+func (c *SSHPolicyCache) fetchToken(logger lager.Logger) (string, error) {
+	formValues := make(url.Values)
+	formValues.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequest("POST", c.uaaTokenURL, strings.NewReader(formValues.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.SetBasicAuth(c.uaaUsername, c.uaaPassword)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("uaa responded with status %d", resp.StatusCode)
+	}
+
+	var tokenResponse UAAAuthTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s", tokenResponse.TokenType, tokenResponse.AccessToken), nil
+}
+
+// SSHPolicyWatcher periodically refreshes an SSHPolicyCache for the
+// applications with active connections and closes the connections to
+// applications for which SSH has been disabled.
+type SSHPolicyWatcher struct {
+	logger   lager.Logger
+	cache    *SSHPolicyCache
+	tracker  ConnectionTracker
+	interval time.Duration
+	clock    clock.Clock
+}
+
+func NewSSHPolicyWatcher(
+	logger lager.Logger,
+	cache *SSHPolicyCache,
+	tracker ConnectionTracker,
+	interval time.Duration,
+	clock clock.Clock,
+) *SSHPolicyWatcher {
+	return &SSHPolicyWatcher{
+		logger:   logger.Session("ssh-policy-watcher"),
+		cache:    cache,
+		tracker:  tracker,
+		interval: interval,
+		clock:    clock,
+	}
+}
+
+func (w *SSHPolicyWatcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	ticker := w.clock.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			w.poll()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (w *SSHPolicyWatcher) poll() {
+	logger := w.logger.Session("poll")
+
+	connected := map[string]bool{}
+	for _, connection := range w.tracker.Connections() {
+		if connection.AppGuid != "" {
+			connected[connection.AppGuid] = true
+		}
+	}
+
+	appGuids := make([]string, 0, len(connected))
+	for appGuid := range connected {
+		appGuids = append(appGuids, appGuid)
+	}
+	sort.Strings(appGuids)
+
+	disabled := w.cache.Refresh(logger, appGuids)
+
+	for _, appGuid := range appGuids {
+		reason, ok := disabled[appGuid]
+		if !ok {
+			continue
+		}
+
+		message := "SSH access to this application has been disabled."
+		if reason != "" {
+			message = fmt.Sprintf("SSH access to this application has been disabled: %s.", strings.TrimSuffix(reason, "."))
+		}
+
+		closed := w.tracker.CloseAppConnections(appGuid, message)
+		logger.Info("closed-connections-for-disabled-app", lager.Data{
+			"app-guid":    appGuid,
+			"reason":      reason,
+			"connections": closed,
+		})
+	}
+}
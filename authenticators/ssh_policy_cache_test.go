@@ -0,0 +1,214 @@
+package authenticators_test
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/diego-ssh/authenticators"
+	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("SSHPolicyCache", func() {
+	var (
+		logger  *lagertest.TestLogger
+		fakeCC  *ghttp.Server
+		fakeUAA *ghttp.Server
+
+		sshEnabled map[string]map[string]interface{}
+
+		cache *authenticators.SSHPolicyCache
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		fakeCC = ghttp.NewServer()
+		fakeUAA = ghttp.NewServer()
+
+		fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.CombineHandlers(
+			ghttp.VerifyBasicAuth("diego-ssh", "diego-ssh-secret"),
+			ghttp.VerifyFormKV("grant_type", "client_credentials"),
+			ghttp.RespondWithJSONEncoded(http.StatusOK, authenticators.UAAAuthTokenResponse{
+				AccessToken: "proxy-token",
+				TokenType:   "bearer",
+			}),
+		))
+
+		sshEnabled = map[string]map[string]interface{}{
+			"enabled-app-guid":  {"enabled": true, "reason": ""},
+			"disabled-app-guid": {"enabled": false, "reason": "Disabled for space dora-space"},
+		}
+
+		for appGuid := range sshEnabled {
+			appGuid := appGuid
+			fakeCC.RouteToHandler("GET", "/v3/apps/"+appGuid+"/ssh_enabled", ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("Authorization", "bearer proxy-token"),
+				func(w http.ResponseWriter, req *http.Request) {
+					ghttp.RespondWithJSONEncoded(http.StatusOK, sshEnabled[appGuid])(w, req)
+				},
+			))
+		}
+
+		cache = authenticators.NewSSHPolicyCache(logger, &http.Client{Timeout: time.Second}, fakeCC.URL(), fakeUAA.URL()+"/oauth/token", "diego-ssh", "diego-ssh-secret")
+	})
+
+	AfterEach(func() {
+		fakeCC.Close()
+		fakeUAA.Close()
+	})
+
+	Describe("Refresh", func() {
+		It("returns the applications for which ssh is disabled", func() {
+			disabled := cache.Refresh(logger, []string{"enabled-app-guid", "disabled-app-guid"})
+			Expect(disabled).To(Equal(map[string]string{
+				"disabled-app-guid": "Disabled for space dora-space",
+			}))
+		})
+
+		It("keeps checking disabled applications until ssh is enabled again", func() {
+			cache.Refresh(logger, []string{"disabled-app-guid"})
+
+			sshEnabled["disabled-app-guid"]["enabled"] = true
+			Expect(cache.Refresh(logger, []string{"disabled-app-guid"})).To(BeEmpty())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("forgets disabled applications that are no longer refreshed", func() {
+			cache.Refresh(logger, []string{"disabled-app-guid"})
+
+			Expect(cache.Refresh(logger, nil)).To(BeEmpty())
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		Context("when the application no longer exists", func() {
+			It("forgets the application", func() {
+				cache.Refresh(logger, []string{"disabled-app-guid"})
+
+				fakeCC.RouteToHandler("GET", "/v3/apps/disabled-app-guid/ssh_enabled", ghttp.RespondWith(http.StatusNotFound, nil))
+				Expect(cache.Refresh(logger, []string{"disabled-app-guid"})).To(BeEmpty())
+			})
+		})
+
+		It("does not contact the cloud controller when there is nothing to check", func() {
+			Expect(cache.Refresh(logger, nil)).To(BeEmpty())
+			Expect(fakeUAA.ReceivedRequests()).To(BeEmpty())
+			Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+		})
+
+		Context("when the cloud controller cannot be reached", func() {
+			It("keeps the previous state", func() {
+				cache.Refresh(logger, []string{"disabled-app-guid"})
+
+				fakeCC.RouteToHandler("GET", "/v3/apps/disabled-app-guid/ssh_enabled", ghttp.RespondWith(http.StatusInternalServerError, nil))
+				Expect(cache.Refresh(logger, []string{"disabled-app-guid"})).To(HaveKey("disabled-app-guid"))
+			})
+		})
+
+		Context("when a token cannot be fetched", func() {
+			BeforeEach(func() {
+				fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.RespondWith(http.StatusUnauthorized, nil))
+			})
+
+			It("does not check any applications", func() {
+				Expect(cache.Refresh(logger, []string{"disabled-app-guid"})).To(BeEmpty())
+				Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("VerifyCredentials", func() {
+		It("fetches a client credentials token", func() {
+			Expect(cache.VerifyCredentials(logger)).To(Succeed())
+			Expect(fakeUAA.ReceivedRequests()).To(HaveLen(1))
+			Expect(fakeCC.ReceivedRequests()).To(BeEmpty())
+		})
+
+		Context("when a token cannot be fetched", func() {
+			BeforeEach(func() {
+				fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.RespondWith(http.StatusUnauthorized, nil))
+			})
+
+			It("returns an error", func() {
+				Expect(cache.VerifyCredentials(logger)).To(MatchError("uaa responded with status 401"))
+			})
+		})
+	})
+
+	Describe("Authorize", func() {
+		BeforeEach(func() {
+			cache.Refresh(logger, []string{"enabled-app-guid", "disabled-app-guid"})
+		})
+
+		It("denies applications for which ssh is disabled", func() {
+			err := cache.Authorize(logger, authenticators.AuthorizationRequest{AppGuid: "disabled-app-guid"})
+			Expect(err).To(Equal(authenticators.SSHDisabledErr))
+		})
+
+		It("allows other applications", func() {
+			Expect(cache.Authorize(logger, authenticators.AuthorizationRequest{AppGuid: "enabled-app-guid"})).To(Succeed())
+			Expect(cache.Authorize(logger, authenticators.AuthorizationRequest{AppGuid: "unknown-app-guid"})).To(Succeed())
+		})
+
+		It("allows connections that are not to applications", func() {
+			Expect(cache.Authorize(logger, authenticators.AuthorizationRequest{User: "diego:process-guid/0"})).To(Succeed())
+		})
+	})
+
+	Describe("SSHPolicyWatcher", func() {
+		var (
+			tracker   *fake_authenticators.FakeConnectionTracker
+			fakeClock *fakeclock.FakeClock
+			process   ifrit.Process
+		)
+
+		BeforeEach(func() {
+			tracker = &fake_authenticators.FakeConnectionTracker{}
+			tracker.ConnectionsReturns([]proxy.ConnectionInfo{
+				{ID: "1", AppGuid: "enabled-app-guid"},
+				{ID: "2", AppGuid: "disabled-app-guid"},
+				{ID: "3", AppGuid: "disabled-app-guid"},
+				{ID: "4"},
+			})
+			tracker.CloseAppConnectionsReturns(2)
+
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+
+			watcher := authenticators.NewSSHPolicyWatcher(logger, cache, tracker, 30*time.Second, fakeClock)
+			process = ifrit.Invoke(watcher)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("does not poll before the interval elapses", func() {
+			Consistently(tracker.ConnectionsCallCount).Should(Equal(0))
+		})
+
+		It("closes the connections to applications for which ssh has been disabled", func() {
+			fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+
+			Eventually(tracker.CloseAppConnectionsCallCount).Should(Equal(1))
+			appGuid, message := tracker.CloseAppConnectionsArgsForCall(0)
+			Expect(appGuid).To(Equal("disabled-app-guid"))
+			Expect(message).To(Equal("SSH access to this application has been disabled: Disabled for space dora-space."))
+		})
+
+		It("refuses new connections to those applications", func() {
+			fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+			Eventually(tracker.CloseAppConnectionsCallCount).Should(Equal(1))
+
+			err := cache.Authorize(logger, authenticators.AuthorizationRequest{AppGuid: "disabled-app-guid"})
+			Expect(err).To(Equal(authenticators.SSHDisabledErr))
+		})
+	})
+})
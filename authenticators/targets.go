@@ -0,0 +1,34 @@
+package authenticators
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"golang.org/x/crypto/ssh"
+)
+
+// targetUserRegexp matches users of the form <realm>:<user>/<target> used by
+// authenticators that proxy to a static set of targets.
+func targetUserRegexp(realm string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`^%s:([^/]+)/([^/]+)$`, regexp.QuoteMeta(realm)))
+}
+
+func targetPermissions(targets map[string]proxy.TargetConfig, name string) (*ssh.Permissions, error) {
+	target, ok := targets[name]
+	if !ok {
+		return nil, UnknownTargetErr
+	}
+
+	targetConfigJson, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.Permissions{
+		CriticalOptions: map[string]string{
+			"proxy-target-config": string(targetConfigJson),
+		},
+	}, nil
+}
@@ -1,8 +1,10 @@
 package authenticators
 
 import (
+	"net"
 	"regexp"
 
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/lager"
 
 	"golang.org/x/crypto/ssh"
@@ -16,11 +18,35 @@ type PublicKeyAuthenticator interface {
 
 //go:generate counterfeiter -o fake_authenticators/fake_password_authenticator.go . PasswordAuthenticator
 type PasswordAuthenticator interface {
+	Realm() string
 	UserRegexp() *regexp.Regexp
 	Authenticate(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error)
 }
 
 //go:generate counterfeiter -o fake_authenticators/fake_permissions_builder.go . PermissionsBuilder
 type PermissionsBuilder interface {
-	Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata) (*ssh.Permissions, error)
+	Build(logger lager.Logger, processGuid string, index int, metadata ssh.ConnMetadata, user string, fetchAppMetadata AppMetadataFetcher) (*ssh.Permissions, error)
+}
+
+// AppMetadataFetcher looks up application metadata that is missing from the
+// tags of the desired LRP.
+type AppMetadataFetcher func(logger lager.Logger) (*proxy.AppMetadata, error)
+
+type AuthorizationRequest struct {
+	User             string
+	AppGuid          string
+	SpaceGuid        string
+	OrganizationGuid string
+	SourceIP         net.IP
+}
+
+//go:generate counterfeiter -o fake_authenticators/fake_authorization_policy.go . AuthorizationPolicy
+type AuthorizationPolicy interface {
+	Authorize(logger lager.Logger, request AuthorizationRequest) error
+}
+
+//go:generate counterfeiter -o fake_authenticators/fake_connection_tracker.go . ConnectionTracker
+type ConnectionTracker interface {
+	Connections() []proxy.ConnectionInfo
+	CloseAppConnections(appGuid string, message string) int
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/debugserver"
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/durationjson"
 	"code.cloudfoundry.org/lager/lagerflags"
 )
@@ -13,39 +14,73 @@ import (
 type SSHProxyConfig struct {
 	lagerflags.LagerConfig
 	debugserver.DebugServerConfig
-	Address                   string                `json:"address,omitempty"`
-	HealthCheckAddress        string                `json:"health_check_address,omitempty"`
-	HostKey                   string                `json:"host_key"`
-	BBSAddress                string                `json:"bbs_address"`
-	CCAPIURL                  string                `json:"cc_api_url"`
-	UAATokenURL               string                `json:"uaa_token_url"`
-	UAAPassword               string                `json:"uaa_password"`
-	UAAUsername               string                `json:"uaa_username"`
-	UAACACert                 string                `json:"uaa_ca_cert"`
-	SkipCertVerify            bool                  `json:"skip_cert_verify"`
-	DropsondePort             int                   `json:"dropsonde_port,omitempty"`
-	EnableCFAuth              bool                  `json:"enable_cf_auth"`
-	EnableDiegoAuth           bool                  `json:"enable_diego_auth"`
-	DiegoCredentials          string                `json:"diego_credentials"`
-	BBSCACert                 string                `json:"bbs_ca_cert"`
-	BBSClientCert             string                `json:"bbs_client_cert"`
-	BBSClientKey              string                `json:"bbs_client_key"`
-	BBSClientSessionCacheSize int                   `json:"bbs_client_session_cache_size"`
-	BBSMaxIdleConnsPerHost    int                   `json:"bbs_max_idle_conns_per_host"`
-	ConsulCluster             string                `json:"consul_cluster"`
-	AllowedCiphers            string                `json:"allowed_ciphers"`
-	AllowedMACs               string                `json:"allowed_macs"`
-	AllowedKeyExchanges       string                `json:"allowed_key_exchanges"`
-	CommunicationTimeout      durationjson.Duration `json:"communication_timeout,omitempty"`
+	Address                   string                        `json:"address,omitempty"`
+	HealthCheckAddress        string                        `json:"health_check_address,omitempty"`
+	HostKey                   string                        `json:"host_key"`
+	BBSAddress                string                        `json:"bbs_address"`
+	CCAPIURL                  string                        `json:"cc_api_url"`
+	UAATokenURL               string                        `json:"uaa_token_url"`
+	UAAPassword               string                        `json:"uaa_password"`
+	UAAUsername               string                        `json:"uaa_username"`
+	UAACACert                 string                        `json:"uaa_ca_cert"`
+	SkipCertVerify            bool                          `json:"skip_cert_verify"`
+	DropsondePort             int                           `json:"dropsonde_port,omitempty"`
+	EnableCFAuth              bool                          `json:"enable_cf_auth"`
+	EnableDiegoAuth           bool                          `json:"enable_diego_auth"`
+	DiegoCredentials          string                        `json:"diego_credentials"`
+	BBSCACert                 string                        `json:"bbs_ca_cert"`
+	BBSClientCert             string                        `json:"bbs_client_cert"`
+	BBSClientKey              string                        `json:"bbs_client_key"`
+	BBSClientSessionCacheSize int                           `json:"bbs_client_session_cache_size"`
+	BBSMaxIdleConnsPerHost    int                           `json:"bbs_max_idle_conns_per_host"`
+	ConsulCluster             string                        `json:"consul_cluster"`
+	AllowedCiphers            string                        `json:"allowed_ciphers"`
+	AllowedMACs               string                        `json:"allowed_macs"`
+	AllowedKeyExchanges       string                        `json:"allowed_key_exchanges"`
+	CommunicationTimeout      durationjson.Duration         `json:"communication_timeout,omitempty"`
+	AuthorizationPolicyFile   string                        `json:"authorization_policy_file"`
+	LoginBanner               string                        `json:"login_banner"`
+	LoginBannerComplianceText string                        `json:"login_banner_compliance_text"`
+	AuthLockoutMaxFailures    int                           `json:"auth_lockout_max_failures"`
+	AuthLockoutWindow         durationjson.Duration         `json:"auth_lockout_window,omitempty"`
+	AuthLockoutDuration       durationjson.Duration         `json:"auth_lockout_duration,omitempty"`
+	CopyBufferSize            int                           `json:"copy_buffer_size,omitempty"`
+	MaxSessionDuration        durationjson.Duration         `json:"max_session_duration,omitempty"`
+	DaemonDialTimeout         durationjson.Duration         `json:"daemon_dial_timeout,omitempty"`
+	DaemonHandshakeTimeout    durationjson.Duration         `json:"daemon_handshake_timeout,omitempty"`
+	ClientHandshakeTimeout    durationjson.Duration         `json:"client_handshake_timeout,omitempty"`
+	HtpasswdFile              string                        `json:"htpasswd_file"`
+	LDAPURL                   string                        `json:"ldap_url"`
+	LDAPBindDN                string                        `json:"ldap_bind_dn"`
+	LDAPBindPassword          string                        `json:"ldap_bind_password"`
+	LDAPBaseDN                string                        `json:"ldap_base_dn"`
+	LDAPUserFilter            string                        `json:"ldap_user_filter"`
+	LDAPCACert                string                        `json:"ldap_ca_cert"`
+	LDAPSkipCertVerify        bool                          `json:"ldap_skip_cert_verify"`
+	Targets                   map[string]proxy.TargetConfig `json:"targets,omitempty"`
+	HealthCheckUser           string                        `json:"health_check_user"`
+	HealthCheckSecret         string                        `json:"health_check_secret"`
+	RoutingAPIURL             string                        `json:"routing_api_url"`
+	RouterGroupGuid           string                        `json:"router_group_guid"`
+	RouteExternalPort         int                           `json:"route_external_port"`
+	RouteBackendIP            string                        `json:"route_backend_ip"`
+	RouteTTL                  durationjson.Duration         `json:"route_ttl,omitempty"`
+	SSHPolicyRefreshInterval  durationjson.Duration         `json:"ssh_policy_refresh_interval,omitempty"`
 }
 
 func defaultConfig() SSHProxyConfig {
 	return SSHProxyConfig{
-		Address:              ":2222",
-		HealthCheckAddress:   ":2223",
-		CommunicationTimeout: durationjson.Duration(10 * time.Second),
-		DropsondePort:        3457,
-		LagerConfig:          lagerflags.DefaultLagerConfig(),
+		Address:                ":2222",
+		HealthCheckAddress:     ":2223",
+		CommunicationTimeout:   durationjson.Duration(10 * time.Second),
+		DropsondePort:          3457,
+		LagerConfig:            lagerflags.DefaultLagerConfig(),
+		AuthLockoutWindow:      durationjson.Duration(5 * time.Minute),
+		AuthLockoutDuration:    durationjson.Duration(15 * time.Minute),
+		DaemonDialTimeout:      durationjson.Duration(10 * time.Second),
+		DaemonHandshakeTimeout: durationjson.Duration(10 * time.Second),
+		LDAPUserFilter:         "(uid=%s)",
+		RouteTTL:               durationjson.Duration(2 * time.Minute),
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 
 	"code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/diego-ssh/cmd/ssh-proxy/config"
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/durationjson"
 	"code.cloudfoundry.org/lager/lagerflags"
 
@@ -43,6 +44,34 @@ var _ = Describe("SSHProxyConfig", func() {
 			"allowed_macs": "mac1,mac2,mac3",
 			"allowed_key_exchanges": "exchange1,exchange2,exchange3",
 			"log_level": "debug",
+			"authorization_policy_file": "/path/to/policy.json",
+			"login_banner": "Welcome to {{.Guid}}/{{.Index}}",
+			"login_banner_compliance_text": "Authorized use only.",
+			"auth_lockout_max_failures": 5,
+			"auth_lockout_window": "2m",
+			"auth_lockout_duration": "30m",
+			"copy_buffer_size": 65536,
+			"max_session_duration": "8h",
+			"daemon_dial_timeout": "3s",
+			"daemon_handshake_timeout": "4s",
+			"client_handshake_timeout": "1m",
+			"htpasswd_file": "/path/to/htpasswd",
+			"ldap_url": "ldaps://ldap.example.com",
+			"ldap_bind_dn": "cn=search,dc=example,dc=com",
+			"ldap_bind_password": "search-password",
+			"ldap_base_dn": "dc=example,dc=com",
+			"ldap_user_filter": "(cn=%s)",
+			"ldap_ca_cert": "/path/to/ldap/ca",
+			"ldap_skip_cert_verify": true,
+			"targets": {"web": {"address": "10.0.0.1:2222", "user": "vcap"}},
+			"health_check_user": "monitor",
+			"health_check_secret": "monitor-secret",
+			"routing_api_url": "https://api.example.com",
+			"router_group_guid": "router-group-guid",
+			"route_external_port": 2222,
+			"route_backend_ip": "10.0.0.1",
+			"route_ttl": "3m",
+			"ssh_policy_refresh_interval": "30s",
 			"debug_address": "5.5.5.5:9090"
 		}`
 	})
@@ -91,6 +120,34 @@ var _ = Describe("SSHProxyConfig", func() {
 			AllowedCiphers:            "cipher1,cipher2,cipher3",
 			AllowedMACs:               "mac1,mac2,mac3",
 			AllowedKeyExchanges:       "exchange1,exchange2,exchange3",
+			AuthorizationPolicyFile:   "/path/to/policy.json",
+			LoginBanner:               "Welcome to {{.Guid}}/{{.Index}}",
+			LoginBannerComplianceText: "Authorized use only.",
+			AuthLockoutMaxFailures:    5,
+			AuthLockoutWindow:         durationjson.Duration(2 * time.Minute),
+			AuthLockoutDuration:       durationjson.Duration(30 * time.Minute),
+			CopyBufferSize:            65536,
+			MaxSessionDuration:        durationjson.Duration(8 * time.Hour),
+			DaemonDialTimeout:         durationjson.Duration(3 * time.Second),
+			DaemonHandshakeTimeout:    durationjson.Duration(4 * time.Second),
+			ClientHandshakeTimeout:    durationjson.Duration(time.Minute),
+			HtpasswdFile:              "/path/to/htpasswd",
+			LDAPURL:                   "ldaps://ldap.example.com",
+			LDAPBindDN:                "cn=search,dc=example,dc=com",
+			LDAPBindPassword:          "search-password",
+			LDAPBaseDN:                "dc=example,dc=com",
+			LDAPUserFilter:            "(cn=%s)",
+			LDAPCACert:                "/path/to/ldap/ca",
+			LDAPSkipCertVerify:        true,
+			Targets:                   map[string]proxy.TargetConfig{"web": {Address: "10.0.0.1:2222", User: "vcap"}},
+			HealthCheckUser:           "monitor",
+			HealthCheckSecret:         "monitor-secret",
+			RoutingAPIURL:             "https://api.example.com",
+			RouterGroupGuid:           "router-group-guid",
+			RouteExternalPort:         2222,
+			RouteBackendIP:            "10.0.0.1",
+			RouteTTL:                  durationjson.Duration(3 * time.Minute),
+			SSHPolicyRefreshInterval:  durationjson.Duration(30 * time.Second),
 			LagerConfig: lagerflags.LagerConfig{
 				LogLevel: lagerflags.DEBUG,
 			},
@@ -183,6 +240,12 @@ var _ = Describe("SSHProxyConfig", func() {
 				AllowedCiphers:            "cipher1,cipher2,cipher3",
 				AllowedMACs:               "mac1,mac2,mac3",
 				AllowedKeyExchanges:       "exchange1,exchange2,exchange3",
+				AuthLockoutWindow:         durationjson.Duration(5 * time.Minute),
+				AuthLockoutDuration:       durationjson.Duration(15 * time.Minute),
+				DaemonDialTimeout:         durationjson.Duration(10 * time.Second),
+				DaemonHandshakeTimeout:    durationjson.Duration(10 * time.Second),
+				LDAPUserFilter:            "(uid=%s)",
+				RouteTTL:                  durationjson.Duration(2 * time.Minute),
 				LagerConfig:               lagerflags.DefaultLagerConfig(),
 				DebugServerConfig: debugserver.DebugServerConfig{
 					DebugAddress: "5.5.5.5:9090",
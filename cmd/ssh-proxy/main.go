@@ -11,7 +11,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/bbs"
@@ -24,6 +27,7 @@ import (
 	"code.cloudfoundry.org/diego-ssh/healthcheck"
 	"code.cloudfoundry.org/diego-ssh/helpers"
 	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/routing"
 	"code.cloudfoundry.org/diego-ssh/server"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
@@ -47,6 +51,12 @@ var configPath = flag.String(
 	"Path to SSH Proxy config.",
 )
 
+var inheritListenerFD = flag.Int(
+	"inheritListenerFD",
+	-1,
+	"File descriptor of an open listener inherited from the parent process.",
+)
+
 func main() {
 	debugserver.AddFlags(flag.CommandLine)
 	flag.Parse()
@@ -61,17 +71,45 @@ func main() {
 
 	cfhttp.Initialize(time.Duration(sshProxyConfig.CommunicationTimeout))
 
+	if sshProxyConfig.CopyBufferSize > 0 {
+		helpers.SetCopyBufferSize(sshProxyConfig.CopyBufferSize)
+	}
+
 	initializeDropsonde(logger, sshProxyConfig.DropsondePort)
 
-	proxySSHServerConfig, err := configureProxy(logger, sshProxyConfig)
+	var sshPolicyCache *authenticators.SSHPolicyCache
+	if sshProxyConfig.SSHPolicyRefreshInterval > 0 {
+		sshPolicyCache, err = initializeSSHPolicyCache(logger, sshProxyConfig)
+		if err != nil {
+			logger.Error("failed-to-configure-ssh-policy-cache", err)
+			os.Exit(1)
+		}
+	}
+
+	proxySSHServerConfig, err := configureProxy(logger, sshProxyConfig, sshPolicyCache)
 	if err != nil {
 		logger.Error("configure-failed", err)
 		os.Exit(1)
 	}
 
-	sshProxy := proxy.New(logger, proxySSHServerConfig)
+	timeouts := proxy.Timeouts{
+		Dial:            time.Duration(sshProxyConfig.DaemonDialTimeout),
+		Handshake:       time.Duration(sshProxyConfig.DaemonHandshakeTimeout),
+		ClientHandshake: time.Duration(sshProxyConfig.ClientHandshakeTimeout),
+	}
+
+	sshProxy := proxy.New(logger, proxySSHServerConfig, time.Duration(sshProxyConfig.MaxSessionDuration), timeouts, clock.NewClock())
 	server := server.NewServer(logger, sshProxyConfig.Address, sshProxy)
 
+	listener, err := acquireListener(logger)
+	if err != nil {
+		logger.Error("failed-to-acquire-listener", err)
+		os.Exit(1)
+	}
+	if listener != nil {
+		server.SetListener(listener)
+	}
+
 	healthCheckHandler := healthcheck.NewHandler(logger)
 	httpServer := http_server.New(sshProxyConfig.HealthCheckAddress, healthCheckHandler)
 
@@ -84,22 +122,52 @@ func main() {
 
 	members := grouper.Members{
 		{"ssh-proxy", server},
-		{"registration-runner", registrationRunner},
-		{"healthcheck", httpServer},
 	}
 
+	if sshProxyConfig.RoutingAPIURL != "" {
+		routeRegistrationRunner, err := initializeRouteRegistrationRunner(logger, sshProxyConfig)
+		if err != nil {
+			logger.Error("failed-to-configure-route-registration", err)
+			os.Exit(1)
+		}
+		members = append(members, grouper.Member{"route-registration", routeRegistrationRunner})
+	}
+
+	if sshPolicyCache != nil {
+		sshPolicyWatcher := authenticators.NewSSHPolicyWatcher(logger, sshPolicyCache, sshProxy, time.Duration(sshProxyConfig.SSHPolicyRefreshInterval), clock.NewClock())
+		members = append(members, grouper.Member{"ssh-policy-watcher", sshPolicyWatcher})
+	}
+
+	members = append(members, grouper.Member{"registration-runner", registrationRunner})
+
+	// The health check and debug servers bind addresses that a process
+	// taking over the listener needs, so they are run separately from the
+	// proxy and its registrations and can be stopped on their own.
+	listenerMembers := grouper.Members{{"healthcheck", httpServer}}
+
 	if sshProxyConfig.DebugAddress != "" {
-		members = append(grouper.Members{{
-			"debug-server", debugserver.Runner(sshProxyConfig.DebugAddress, reconfigurableSink),
-		}}, members...)
+		listenerMembers = append(listenerMembers, grouper.Member{
+			"debug-server", initializeDebugServer(logger, sshProxyConfig.DebugAddress, reconfigurableSink, sshProxy),
+		})
 	}
 
-	group := grouper.NewOrdered(os.Interrupt, members)
-	monitor := ifrit.Invoke(sigmon.New(group))
+	monitor := ifrit.Invoke(sigmon.New(grouper.NewOrdered(os.Interrupt, members)))
+	listenerMonitor := ifrit.Invoke(sigmon.New(grouper.NewOrdered(os.Interrupt, listenerMembers)))
+
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
 
 	logger.Info("started")
 
-	err = <-monitor.Wait()
+	select {
+	case err = <-monitor.Wait():
+		stop(listenerMonitor)
+	case err = <-listenerMonitor.Wait():
+		stop(monitor)
+	case <-upgrade:
+		err = handoff(logger, server, monitor, listenerMonitor)
+	}
+
 	if err != nil {
 		logger.Error("exited-with-failure", err)
 		os.Exit(1)
@@ -109,32 +177,106 @@ func main() {
 	os.Exit(0)
 }
 
-func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (*ssh.ServerConfig, error) {
-	if sshProxyConfig.BBSAddress == "" {
-		err := errors.New("bbsAddress is required")
-		logger.Fatal("bbs-address-required", err)
+func acquireListener(logger lager.Logger) (net.Listener, error) {
+	if *inheritListenerFD >= 0 {
+		logger.Info("inheriting-listener", lager.Data{"fd": *inheritListenerFD})
+		return server.InheritedListener(uintptr(*inheritListenerFD))
+	}
+
+	listener, err := server.SystemdListener()
+	if listener != nil {
+		logger.Info("using-systemd-listener")
+	}
+	return listener, err
+}
+
+func stop(process ifrit.Process) {
+	process.Signal(os.Interrupt)
+	<-process.Wait()
+}
+
+// handoff starts a new ssh-proxy process that inherits the listener, stops
+// this process from accepting connections, and waits for the established
+// connections to complete. The listening socket remains open throughout so
+// clients are queued by the kernel rather than refused. Only the health check
+// and debug servers are stopped before the new process starts; the consul and
+// TCP route registrations are left in place for the new process to take over.
+func handoff(logger lager.Logger, proxyServer *server.Server, monitor, listenerMonitor ifrit.Process) error {
+	logger = logger.Session("handoff")
+	logger.Info("starting")
+	defer logger.Info("finished")
+
+	listenerFile, err := proxyServer.ListenerFile()
+	if err != nil {
+		logger.Error("failed-to-get-listener-file", err)
+		stop(listenerMonitor)
+		stop(monitor)
+		return err
 	}
+	defer listenerFile.Close()
+
+	proxyServer.Drain()
 
-	url, err := url.Parse(sshProxyConfig.BBSAddress)
+	listenerMonitor.Signal(os.Interrupt)
+	err = <-listenerMonitor.Wait()
 	if err != nil {
-		logger.Fatal("failed-to-parse-bbs-address", err)
+		logger.Error("failed-to-stop-listeners", err)
 	}
 
-	bbsClient := initializeBBSClient(
-		logger,
-		sshProxyConfig.BBSAddress,
-		sshProxyConfig.BBSCACert,
-		sshProxyConfig.BBSClientCert,
-		sshProxyConfig.BBSClientKey,
-		sshProxyConfig.BBSClientSessionCacheSize,
-		sshProxyConfig.BBSMaxIdleConnsPerHost,
-	)
-	permissionsBuilder := authenticators.NewPermissionsBuilder(bbsClient)
+	args := server.InheritListenerArgs(os.Args[1:], "inheritListenerFD", 3)
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{listenerFile}
+
+	err = cmd.Start()
+	if err != nil {
+		logger.Error("failed-to-start-process", err)
+		stop(monitor)
+		return err
+	}
+	logger.Info("started-process", lager.Data{"pid": cmd.Process.Pid})
+
+	logger.Info("waiting-for-connections")
+	proxyServer.WaitForConnections()
 
+	return nil
+}
+
+func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig, sshPolicyCache *authenticators.SSHPolicyCache) (*ssh.ServerConfig, error) {
 	authens := []authenticators.PasswordAuthenticator{}
 
+	var permissionsBuilder authenticators.PermissionsBuilder
+	if sshProxyConfig.EnableDiegoAuth || sshProxyConfig.EnableCFAuth {
+		if sshProxyConfig.BBSAddress == "" {
+			err := errors.New("bbsAddress is required")
+			logger.Fatal("bbs-address-required", err)
+		}
+
+		_, err := url.Parse(sshProxyConfig.BBSAddress)
+		if err != nil {
+			logger.Fatal("failed-to-parse-bbs-address", err)
+		}
+
+		bbsClient := initializeBBSClient(
+			logger,
+			sshProxyConfig.BBSAddress,
+			sshProxyConfig.BBSCACert,
+			sshProxyConfig.BBSClientCert,
+			sshProxyConfig.BBSClientKey,
+			sshProxyConfig.BBSClientSessionCacheSize,
+			sshProxyConfig.BBSMaxIdleConnsPerHost,
+		)
+		permissionsBuilder = authenticators.NewPermissionsBuilder(bbsClient)
+	}
+
 	if sshProxyConfig.EnableDiegoAuth {
-		diegoAuthenticator := authenticators.NewDiegoProxyAuthenticator(logger, []byte(sshProxyConfig.DiegoCredentials), permissionsBuilder)
+		if sshProxyConfig.DiegoCredentials == "" {
+			return nil, errors.New("diegoCredentials is required for Diego authentication")
+		}
+
+		diegoAuthenticator := authenticators.NewDiegoProxyAuthenticator(logger, []byte(sshProxyConfig.DiegoCredentials), permissionsBuilder, clock.NewClock())
 		authens = append(authens, diegoAuthenticator)
 	}
 
@@ -143,7 +285,7 @@ func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (
 			return nil, errors.New("ccAPIURL is required for Cloud Foundry authentication")
 		}
 
-		_, err = url.Parse(sshProxyConfig.CCAPIURL)
+		_, err := url.Parse(sshProxyConfig.CCAPIURL)
 		if err != nil {
 			return nil, err
 		}
@@ -182,7 +324,85 @@ func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (
 		authens = append(authens, cfAuthenticator)
 	}
 
-	authenticator := authenticators.NewCompositeAuthenticator(authens...)
+	// The authorization policy and the ssh policy cache govern sessions to
+	// applications, so they only wrap the realms that connect to LRPs.
+	if sshProxyConfig.AuthorizationPolicyFile != "" {
+		policy, err := authenticators.NewFileAuthorizationPolicy(sshProxyConfig.AuthorizationPolicyFile, clock.NewClock())
+		if err != nil {
+			logger.Error("failed-to-load-authorization-policy", err)
+			return nil, err
+		}
+
+		for i, authen := range authens {
+			authens[i] = authenticators.NewPolicyAuthenticator(logger, authen, policy)
+		}
+	}
+
+	if sshPolicyCache != nil {
+		for i, authen := range authens {
+			authens[i] = authenticators.NewPolicyAuthenticator(logger, authen, sshPolicyCache)
+		}
+	}
+
+	if sshProxyConfig.HtpasswdFile != "" {
+		htpasswdAuthenticator, err := authenticators.NewHtpasswdAuthenticator(logger, sshProxyConfig.HtpasswdFile, sshProxyConfig.Targets)
+		if err != nil {
+			logger.Error("failed-to-load-htpasswd-file", err)
+			return nil, err
+		}
+		authens = append(authens, htpasswdAuthenticator)
+	}
+
+	if sshProxyConfig.LDAPURL != "" {
+		tlsConfig, err := newLDAPTLSConfig(sshProxyConfig.LDAPSkipCertVerify, sshProxyConfig.LDAPCACert)
+		if err != nil {
+			logger.Error("failed-to-configure-ldap-tls", err)
+			return nil, err
+		}
+
+		dialer, err := authenticators.NewLDAPDialer(sshProxyConfig.LDAPURL, tlsConfig)
+		if err != nil {
+			logger.Error("failed-to-parse-ldap-url", err)
+			return nil, err
+		}
+
+		ldapAuthenticator, err := authenticators.NewLDAPAuthenticator(
+			logger,
+			dialer,
+			sshProxyConfig.LDAPBindDN,
+			sshProxyConfig.LDAPBindPassword,
+			sshProxyConfig.LDAPBaseDN,
+			sshProxyConfig.LDAPUserFilter,
+			sshProxyConfig.Targets,
+		)
+		if err != nil {
+			logger.Error("invalid-ldap-user-filter", err)
+			return nil, err
+		}
+		authens = append(authens, ldapAuthenticator)
+	}
+
+	if sshProxyConfig.HealthCheckUser != "" {
+		if sshProxyConfig.HealthCheckSecret == "" {
+			return nil, errors.New("healthCheckSecret is required when healthCheckUser is set")
+		}
+
+		healthCheckAuthenticator := authenticators.NewHealthCheckAuthenticator(logger, sshProxyConfig.HealthCheckUser, sshProxyConfig.HealthCheckSecret)
+		authens = append(authens, healthCheckAuthenticator)
+	}
+
+	var authenticator authenticators.Authenticator = authenticators.NewCompositeAuthenticator(authens...)
+
+	if sshProxyConfig.AuthLockoutMaxFailures > 0 {
+		authenticator = authenticators.NewLockoutAuthenticator(
+			logger,
+			authenticator,
+			clock.NewClock(),
+			sshProxyConfig.AuthLockoutMaxFailures,
+			time.Duration(sshProxyConfig.AuthLockoutWindow),
+			time.Duration(sshProxyConfig.AuthLockoutDuration),
+		)
+	}
 
 	sshConfig := &ssh.ServerConfig{
 		PasswordCallback: authenticator.Authenticate,
@@ -195,6 +415,15 @@ func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (
 		},
 	}
 
+	if sshProxyConfig.LoginBanner != "" {
+		bannerCallback, err := proxy.NewBannerCallback(logger, sshProxyConfig.LoginBanner, sshProxyConfig.LoginBannerComplianceText)
+		if err != nil {
+			logger.Error("failed-to-parse-login-banner", err)
+			return nil, err
+		}
+		sshConfig.BannerCallback = bannerCallback
+	}
+
 	if sshProxyConfig.HostKey == "" {
 		err := errors.New("hostKey is required")
 		logger.Fatal("host-key-required", err)
@@ -220,6 +449,63 @@ func configureProxy(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (
 	return sshConfig, err
 }
 
+func initializeSSHPolicyCache(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (*authenticators.SSHPolicyCache, error) {
+	if !sshProxyConfig.EnableCFAuth {
+		return nil, errors.New("Cloud Foundry authentication is required to refresh ssh policy")
+	}
+
+	httpClient, err := helpers.NewHTTPSClient(sshProxyConfig.SkipCertVerify, sshProxyConfig.UAACACert, time.Duration(sshProxyConfig.CommunicationTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	sshPolicyCache := authenticators.NewSSHPolicyCache(
+		logger,
+		httpClient,
+		sshProxyConfig.CCAPIURL,
+		sshProxyConfig.UAATokenURL,
+		sshProxyConfig.UAAUsername,
+		sshProxyConfig.UAAPassword,
+	)
+
+	err = sshPolicyCache.VerifyCredentials(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch a client credentials token to refresh ssh policy: %s", err.Error())
+	}
+
+	return sshPolicyCache, nil
+}
+
+func newLDAPTLSConfig(insecureSkipVerify bool, caCertFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caCertFile != "" {
+		certBytes, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca cert file: %s", err.Error())
+		}
+
+		caCertPool := x509.NewCertPool()
+		if ok := caCertPool.AppendCertsFromPEM(certBytes); !ok {
+			return nil, errors.New("Unable to load caCert")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	return tlsConfig, nil
+}
+
+func initializeDebugServer(logger lager.Logger, address string, sink *lager.ReconfigurableSink, sshProxy *proxy.Proxy) ifrit.Runner {
+	connectionsHandler := proxy.NewConnectionsHandler(logger, sshProxy)
+
+	mux := http.NewServeMux()
+	mux.Handle("/connections", connectionsHandler)
+	mux.Handle("/connections/", connectionsHandler)
+	mux.Handle("/", debugserver.Handler(sink))
+
+	return http_server.New(address, mux)
+}
+
 func initializeDropsonde(logger lager.Logger, dropsondePort int) {
 	dropsondeDestination := fmt.Sprint("localhost:", dropsondePort)
 	err := dropsonde.Initialize(dropsondeDestination, dropsondeOrigin)
@@ -312,3 +598,70 @@ func initializeRegistrationRunner(logger lager.Logger, consulClient consuladapte
 
 	return locket.NewRegistrationRunner(logger, registration, consulClient, locket.RetryInterval, clock)
 }
+
+// minRouteTTL is the shortest route TTL accepted. Routes are refreshed every
+// third of the TTL, and the routing API only accepts whole seconds.
+const minRouteTTL = 3 * time.Second
+
+// initializeRouteRegistrationRunner registers the proxy's listen port as a
+// TCP route with the routing API. The runner is stopped before the proxy
+// server, so the route is removed while the proxy drains.
+func initializeRouteRegistrationRunner(logger lager.Logger, sshProxyConfig config.SSHProxyConfig) (ifrit.Runner, error) {
+	if sshProxyConfig.RouterGroupGuid == "" {
+		return nil, errors.New("routerGroupGuid is required for route registration")
+	}
+
+	if sshProxyConfig.RouteExternalPort <= 0 || sshProxyConfig.RouteExternalPort > 65535 {
+		return nil, errors.New("a valid routeExternalPort is required for route registration")
+	}
+
+	if time.Duration(sshProxyConfig.RouteTTL) < minRouteTTL {
+		return nil, fmt.Errorf("routeTTL must be at least %s", minRouteTTL)
+	}
+
+	if sshProxyConfig.UAATokenURL == "" || sshProxyConfig.UAAUsername == "" || sshProxyConfig.UAAPassword == "" {
+		return nil, errors.New("UAA credentials are required for route registration")
+	}
+
+	host, portString, err := net.SplitHostPort(sshProxyConfig.Address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort("tcp", portString)
+	if err != nil {
+		return nil, err
+	}
+
+	backendIP := sshProxyConfig.RouteBackendIP
+	if backendIP == "" {
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsUnspecified() {
+			return nil, errors.New("routeBackendIP is required when the proxy listens on all interfaces")
+		}
+		backendIP = ip.String()
+	}
+
+	httpClient, err := helpers.NewHTTPSClient(sshProxyConfig.SkipCertVerify, sshProxyConfig.UAACACert, time.Duration(sshProxyConfig.CommunicationTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	client := routing.NewClient(
+		httpClient,
+		sshProxyConfig.RoutingAPIURL,
+		sshProxyConfig.UAATokenURL,
+		sshProxyConfig.UAAUsername,
+		sshProxyConfig.UAAPassword,
+	)
+
+	ttl := time.Duration(sshProxyConfig.RouteTTL)
+	mappings := []routing.TCPRouteMapping{{
+		RouterGroupGuid: sshProxyConfig.RouterGroupGuid,
+		Port:            uint16(sshProxyConfig.RouteExternalPort),
+		BackendIP:       backendIP,
+		BackendPort:     uint16(port),
+		TTL:             int(ttl.Seconds()),
+	}}
+
+	return routing.NewRegistrationRunner(logger, client, mappings, ttl/3, clock.NewClock()), nil
+}
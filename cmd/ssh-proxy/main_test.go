@@ -17,11 +17,14 @@ import (
 	"code.cloudfoundry.org/diego-ssh/cmd/ssh-proxy/config"
 	"code.cloudfoundry.org/diego-ssh/cmd/ssh-proxy/testrunner"
 	"code.cloudfoundry.org/diego-ssh/helpers"
+	"code.cloudfoundry.org/diego-ssh/proxy"
 	"code.cloudfoundry.org/diego-ssh/routes"
+	"code.cloudfoundry.org/durationjson"
 	"github.com/gogo/protobuf/proto"
 	"github.com/hashicorp/consul/api"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/ginkgomon"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh"
 
 	. "github.com/onsi/ginkgo"
@@ -57,6 +60,16 @@ var _ = Describe("SSH proxy", func() {
 		allowedCiphers              string
 		allowedMACs                 string
 		allowedKeyExchanges         string
+		healthCheckUser             string
+		healthCheckSecret           string
+		routingAPIURL               string
+		routerGroupGuid             string
+		routeExternalPort           int
+		routeTTL                    time.Duration
+		sshPolicyRefreshInterval    time.Duration
+		authorizationPolicyFile     string
+		htpasswdFile                string
+		targets                     map[string]proxy.TargetConfig
 		expectedGetActualLRPRequest *models.ActualLRPGroupByProcessGuidAndIndexRequest
 		actualLRPGroupResponse      *models.ActualLRPGroupResponse
 		getDesiredLRPRequest        *models.DesiredLRPByProcessGuidRequest
@@ -98,6 +111,16 @@ var _ = Describe("SSH proxy", func() {
 		allowedCiphers = ""
 		allowedMACs = ""
 		allowedKeyExchanges = ""
+		healthCheckUser = ""
+		healthCheckSecret = ""
+		routingAPIURL = ""
+		routerGroupGuid = ""
+		routeExternalPort = 0
+		routeTTL = 0
+		sshPolicyRefreshInterval = 0
+		authorizationPolicyFile = ""
+		htpasswdFile = ""
+		targets = nil
 
 		expectedGetActualLRPRequest = &models.ActualLRPGroupByProcessGuidAndIndexRequest{
 			ProcessGuid: processGuid,
@@ -169,6 +192,17 @@ var _ = Describe("SSH proxy", func() {
 			AllowedCiphers:      allowedCiphers,
 			AllowedMACs:         allowedMACs,
 			AllowedKeyExchanges: allowedKeyExchanges,
+			HealthCheckUser:     healthCheckUser,
+			HealthCheckSecret:   healthCheckSecret,
+			RoutingAPIURL:       routingAPIURL,
+			RouterGroupGuid:     routerGroupGuid,
+			RouteExternalPort:   routeExternalPort,
+			RouteTTL:            durationjson.Duration(routeTTL),
+
+			SSHPolicyRefreshInterval: durationjson.Duration(sshPolicyRefreshInterval),
+			AuthorizationPolicyFile:  authorizationPolicyFile,
+			HtpasswdFile:             htpasswdFile,
+			Targets:                  targets,
 		}
 
 		configData, err := json.Marshal(&sshProxyConfig)
@@ -243,6 +277,32 @@ var _ = Describe("SSH proxy", func() {
 			})
 		})
 
+		Context("when the route TTL is too short", func() {
+			BeforeEach(func() {
+				routingAPIURL = "https://routing-api.example.com"
+				routerGroupGuid = "router-group-guid"
+				routeExternalPort = 2222
+				routeTTL = time.Second
+			})
+
+			It("reports the problem and terminates", func() {
+				Expect(runner).To(gbytes.Say("routeTTL must be at least 3s"))
+				Expect(runner).NotTo(gexec.Exit(0))
+			})
+		})
+
+		Context("when Diego authentication is enabled without credentials", func() {
+			BeforeEach(func() {
+				enableDiegoAuth = true
+				diegoCredentials = ""
+			})
+
+			It("reports the problem and terminates", func() {
+				Expect(runner).To(gbytes.Say("diegoCredentials is required for Diego authentication"))
+				Expect(runner).NotTo(gexec.Exit(0))
+			})
+		})
+
 		Context("when CF authentication is enabled", func() {
 			BeforeEach(func() {
 				enableCFAuth = true
@@ -324,6 +384,21 @@ var _ = Describe("SSH proxy", func() {
 					Expect(runner).To(gexec.Exit(1))
 				})
 			})
+
+			Context("when ssh policy refresh is enabled and the UAA rejects the client credentials", func() {
+				BeforeEach(func() {
+					sshPolicyRefreshInterval = time.Minute
+					fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.CombineHandlers(
+						ghttp.VerifyFormKV("grant_type", "client_credentials"),
+						ghttp.RespondWith(http.StatusUnauthorized, nil),
+					))
+				})
+
+				It("exits with an error", func() {
+					Expect(runner).To(gbytes.Say("failed-to-configure-ssh-policy-cache"))
+					Expect(runner).To(gexec.Exit(1))
+				})
+			})
 		})
 	})
 
@@ -424,7 +499,7 @@ var _ = Describe("SSH proxy", func() {
 		BeforeEach(func() {
 			clientConfig = &ssh.ClientConfig{
 				User: processGuid + "/99",
-				Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+				Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 			}
 		})
 
@@ -439,7 +514,7 @@ var _ = Describe("SSH proxy", func() {
 		BeforeEach(func() {
 			clientConfig = &ssh.ClientConfig{
 				User: "goo:" + processGuid + "/99",
-				Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+				Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 			}
 		})
 
@@ -450,11 +525,44 @@ var _ = Describe("SSH proxy", func() {
 		})
 	})
 
+	Describe("authenticating with the healthcheck realm", func() {
+		BeforeEach(func() {
+			healthCheckUser = "monitor"
+			healthCheckSecret = "monitor-secret"
+
+			clientConfig = &ssh.ClientConfig{
+				User: "healthcheck:monitor",
+				Auth: []ssh.AuthMethod{ssh.Password("monitor-secret")},
+			}
+		})
+
+		It("completes the handshake and closes the connection", func() {
+			client, err := ssh.Dial("tcp", address, clientConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(client.Wait).Should(HaveOccurred())
+			Expect(fakeBBS.ReceivedRequests()).To(HaveLen(0))
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(0))
+			Expect(fakeUAA.ReceivedRequests()).To(HaveLen(0))
+		})
+
+		Context("when the secret is wrong", func() {
+			BeforeEach(func() {
+				clientConfig.Auth = []ssh.AuthMethod{ssh.Password("guess")}
+			})
+
+			It("fails the authentication", func() {
+				_, err := ssh.Dial("tcp", address, clientConfig)
+				Expect(err).To(MatchError(ContainSubstring("ssh: handshake failed")))
+			})
+		})
+	})
+
 	Describe("authenticating with the diego realm", func() {
 		BeforeEach(func() {
 			clientConfig = &ssh.ClientConfig{
 				User: "diego:" + processGuid + "/99",
-				Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+				Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 			}
 		})
 
@@ -496,7 +604,7 @@ var _ = Describe("SSH proxy", func() {
 				allowedCiphers = "aes128-ctr,aes256-ctr"
 				clientConfig = &ssh.ClientConfig{
 					User: "diego:" + processGuid + "/99",
-					Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+					Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 				}
 			})
 
@@ -524,7 +632,7 @@ var _ = Describe("SSH proxy", func() {
 				allowedMACs = "hmac-sha2-256,hmac-sha1"
 				clientConfig = &ssh.ClientConfig{
 					User: "diego:" + processGuid + "/99",
-					Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+					Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 				}
 			})
 
@@ -552,7 +660,7 @@ var _ = Describe("SSH proxy", func() {
 				allowedKeyExchanges = "curve25519-sha256@libssh.org,ecdh-sha2-nistp384,diffie-hellman-group14-sha1"
 				clientConfig = &ssh.ClientConfig{
 					User: "diego:" + processGuid + "/99",
-					Auth: []ssh.AuthMethod{ssh.Password(diegoCredentials)},
+					Auth: []ssh.AuthMethod{ssh.Password(diegoPassword(diegoCredentials, processGuid))},
 				}
 			})
 
@@ -566,6 +674,9 @@ var _ = Describe("SSH proxy", func() {
 		Context("when a non-existent process guid is used", func() {
 			BeforeEach(func() {
 				clientConfig.User = "diego:bad-process-guid/999"
+				clientConfig.Auth = []ssh.AuthMethod{
+					ssh.Password(diegoPassword(diegoCredentials, "bad-process-guid")),
+				}
 				expectedGetActualLRPRequest = &models.ActualLRPGroupByProcessGuidAndIndexRequest{
 					ProcessGuid: "bad-process-guid",
 					Index:       999,
@@ -612,6 +723,65 @@ var _ = Describe("SSH proxy", func() {
 		})
 	})
 
+	Describe("authenticating with the htpasswd realm", func() {
+		BeforeEach(func() {
+			hash, err := bcrypt.GenerateFromPassword([]byte("htpasswd-secret"), bcrypt.MinCost)
+			Expect(err).NotTo(HaveOccurred())
+
+			htpasswd, err := ioutil.TempFile("", "htpasswd")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fmt.Fprintf(htpasswd, "alice:%s\n", hash)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(htpasswd.Close()).To(Succeed())
+			htpasswdFile = htpasswd.Name()
+
+			targets = map[string]proxy.TargetConfig{
+				"build-box": {
+					Address:         fmt.Sprintf("127.0.0.1:%d", sshdPort),
+					HostFingerprint: hostKeyFingerprint,
+					PrivateKey:      privateKeyPem,
+				},
+			}
+
+			clientConfig = &ssh.ClientConfig{
+				User: "htpasswd:alice/build-box",
+				Auth: []ssh.AuthMethod{ssh.Password("htpasswd-secret")},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(htpasswdFile)).To(Succeed())
+		})
+
+		Context("when the authorization policy denies spaces", func() {
+			BeforeEach(func() {
+				policy, err := ioutil.TempFile("", "authorization-policy")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = policy.WriteString(`{"deny_spaces": ["space-guid"]}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(policy.Close()).To(Succeed())
+				authorizationPolicyFile = policy.Name()
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(authorizationPolicyFile)).To(Succeed())
+			})
+
+			It("does not apply the policy and connects to the target", func() {
+				client, err := ssh.Dial("tcp", address, clientConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				session, err := client.NewSession()
+				Expect(err).NotTo(HaveOccurred())
+
+				output, err := session.Output("echo -n hello")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(Equal("hello"))
+			})
+		})
+	})
+
 	Describe("authenticating with the cf realm with a one time code", func() {
 		BeforeEach(func() {
 			clientConfig = &ssh.ClientConfig{
@@ -638,6 +808,19 @@ var _ = Describe("SSH proxy", func() {
 					ProcessGuid: processGuid,
 				}),
 			))
+
+			fakeCC.RouteToHandler("GET", "/v3/apps/60f0f26e-86b3-4487-8f19-9e94f848f3d2", ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/v3/apps/60f0f26e-86b3-4487-8f19-9e94f848f3d2", "include=space.organization"),
+				ghttp.RespondWith(http.StatusOK, `{
+					"guid": "60f0f26e-86b3-4487-8f19-9e94f848f3d2",
+					"name": "some-app",
+					"relationships": {"space": {"data": {"guid": "space-guid"}}},
+					"included": {
+						"spaces": [{"guid": "space-guid", "name": "some-space", "relationships": {"organization": {"data": {"guid": "org-guid"}}}}],
+						"organizations": [{"guid": "org-guid", "name": "some-org"}]
+					}
+				}`),
+			))
 		})
 
 		It("provides the access code to the UAA and and gets an access token", func() {
@@ -649,13 +832,13 @@ var _ = Describe("SSH proxy", func() {
 			Expect(fakeUAA.ReceivedRequests()).To(HaveLen(1))
 		})
 
-		It("provides a bearer token to the CC and gets the process guid", func() {
+		It("provides a bearer token to the CC and gets the process guid and app metadata", func() {
 			client, err := ssh.Dial("tcp", address, clientConfig)
 			Expect(err).NotTo(HaveOccurred())
 
 			client.Close()
 
-			Expect(fakeCC.ReceivedRequests()).To(HaveLen(1))
+			Expect(fakeCC.ReceivedRequests()).To(HaveLen(2))
 		})
 
 		It("acquires the lrp info from the BBS using the process guid from the CC", func() {
@@ -682,6 +865,10 @@ var _ = Describe("SSH proxy", func() {
 	})
 })
 
+func diegoPassword(secret, processGuid string) string {
+	return authenticators.NewDiegoCredentials([]byte(secret), processGuid, time.Now().Add(time.Hour))
+}
+
 func VerifyProto(expected proto.Message) http.HandlerFunc {
 	return ghttp.CombineHandlers(
 		ghttp.VerifyContentType("application/x-protobuf"),
@@ -15,7 +15,7 @@ func newChannelHandlers() map[string]handlers.NewChannelHandler {
 	dialer := &net.Dialer{}
 
 	return map[string]handlers.NewChannelHandler{
-		"session":      handlers.NewSessionChannelHandler(runner, shellLocator, getDaemonEnvironment(), 15*time.Second),
+		"session":      handlers.NewSessionChannelHandler(runner, shellLocator, getDaemonEnvironment(), 15*time.Second, *motd, *rsyncPath, *sftpServerPath),
 		"direct-tcpip": handlers.NewDirectTcpipChannelHandler(dialer),
 	}
 }
@@ -5,7 +5,10 @@ package main
 import "code.cloudfoundry.org/diego-ssh/handlers"
 
 func newChannelHandlers() map[string]handlers.NewChannelHandler {
+	runner := handlers.NewCommandRunner()
+	shellLocator := handlers.NewShellLocator()
+
 	return map[string]handlers.NewChannelHandler{
-		"session": handlers.NewSessionChannelHandler(),
+		"session": handlers.NewSessionChannelHandler(runner, shellLocator, getDaemonEnvironment()),
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/diego-ssh/authenticators"
 	"code.cloudfoundry.org/diego-ssh/daemon"
+	"code.cloudfoundry.org/diego-ssh/helpers"
 	"code.cloudfoundry.org/diego-ssh/keys"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
@@ -30,7 +32,13 @@ var address = flag.String(
 var hostKey = flag.String(
 	"hostKey",
 	"",
-	"PEM encoded RSA host key",
+	"PEM encoded host key",
+)
+
+var generatedHostKeyPath = flag.String(
+	"generatedHostKeyPath",
+	"",
+	"Path to write the host key generated when hostKey is not provided",
 )
 
 var authorizedKey = flag.String(
@@ -69,6 +77,30 @@ var allowedKeyExchanges = flag.String(
 	"Limit key exchanges algorithms to those provided (comma separated)",
 )
 
+var motd = flag.String(
+	"motd",
+	"",
+	"Message of the day displayed at the start of interactive shells",
+)
+
+var rsyncPath = flag.String(
+	"rsyncPath",
+	"",
+	"Path to the rsync binary used to serve rsync clients (defaults to rsync on the PATH of the session)",
+)
+
+var sftpServerPath = flag.String(
+	"sftpServerPath",
+	"",
+	"Path to an external sftp-server binary used to serve the sftp subsystem",
+)
+
+var maxSessionsPerConnection = flag.Int(
+	"maxSessionsPerConnection",
+	0,
+	"Maximum number of concurrent session channels on a single connection (0 for unlimited)",
+)
+
 var hostKeyPEM string
 var authorizedKeyValue string
 
@@ -91,7 +123,7 @@ func main() {
 		hostKeyPEM = *hostKey
 		if hostKeyPEM == "" {
 			var err error
-			hostKeyPEM, err = generateNewHostKey()
+			hostKeyPEM, err = generateNewHostKey(logger, *generatedHostKeyPath)
 			if err != nil {
 				logger.Error("failed-to-generate-host-key", err)
 				os.Exit(1)
@@ -120,6 +152,10 @@ func main() {
 			fmt.Sprintf("--inheritDaemonEnv=%t", *inheritDaemonEnv),
 			fmt.Sprintf("--allowedCiphers=%s", *allowedCiphers),
 			fmt.Sprintf("--allowedMACs=%s", *allowedMACs),
+			fmt.Sprintf("--motd=%s", *motd),
+			fmt.Sprintf("--rsyncPath=%s", *rsyncPath),
+			fmt.Sprintf("--sftpServerPath=%s", *sftpServerPath),
+			fmt.Sprintf("--maxSessionsPerConnection=%d", *maxSessionsPerConnection),
 			fmt.Sprintf("--logLevel=%s", logLevel),
 			fmt.Sprintf("--debugAddr=%s", debugserver.DebugAddress(flag.CommandLine)),
 		}, os.Environ())
@@ -135,7 +171,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	sshDaemon := daemon.New(logger, serverConfig, nil, newChannelHandlers())
+	sshDaemon := daemon.New(logger, serverConfig, nil, newChannelHandlers(), *maxSessionsPerConnection)
 	server, err := createServer(logger, *address, sshDaemon)
 
 	members := grouper.Members{
@@ -245,11 +281,23 @@ func acquireHostKey(logger lager.Logger) (ssh.Signer, error) {
 	return key, nil
 }
 
-func generateNewHostKey() (string, error) {
-	hostKeyPair, err := keys.RSAKeyPairFactory.NewKeyPair(1024)
-
+func generateNewHostKey(logger lager.Logger, path string) (string, error) {
+	hostKeyPair, err := keys.Ed25519KeyPairFactory.NewKeyPair(0)
 	if err != nil {
 		return "", err
 	}
+
+	logger.Info("generated-host-key", lager.Data{
+		"md5-fingerprint":  hostKeyPair.Fingerprint(),
+		"sha1-fingerprint": helpers.SHA1Fingerprint(hostKeyPair.PublicKey()),
+	})
+
+	if path != "" {
+		err = ioutil.WriteFile(path, []byte(hostKeyPair.PEMEncodedPrivateKey()), 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return hostKeyPair.PEMEncodedPrivateKey(), nil
 }
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/diego-ssh/cmd/sshd/testrunner"
+	"code.cloudfoundry.org/diego-ssh/helpers"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/ginkgomon"
 	"golang.org/x/crypto/ssh"
@@ -34,6 +36,7 @@ var _ = Describe("SSH daemon", func() {
 
 		address       string
 		hostKey       string
+		hostKeyPath   string
 		privateKey    string
 		authorizedKey string
 
@@ -47,6 +50,7 @@ var _ = Describe("SSH daemon", func() {
 
 	BeforeEach(func() {
 		hostKey = hostKeyPem
+		hostKeyPath = ""
 		privateKey = privateKeyPem
 		authorizedKey = publicAuthorizedKey
 
@@ -61,9 +65,10 @@ var _ = Describe("SSH daemon", func() {
 
 	JustBeforeEach(func() {
 		args := testrunner.Args{
-			Address:       address,
-			HostKey:       string(hostKey),
-			AuthorizedKey: string(authorizedKey),
+			Address:              address,
+			HostKey:              string(hostKey),
+			GeneratedHostKeyPath: hostKeyPath,
+			AuthorizedKey:        string(authorizedKey),
 
 			AllowedCiphers:      string(allowedCiphers),
 			AllowedMACs:         string(allowedMACs),
@@ -254,10 +259,17 @@ var _ = Describe("SSH daemon", func() {
 		}
 
 		Context("when a host key is not specified", func() {
+			var handshakeHostKey ssh.PublicKey
+
 			BeforeEach(func() {
 				hostKey = ""
 				allowUnauthenticatedClients = true
-				clientConfig = &ssh.ClientConfig{}
+				clientConfig = &ssh.ClientConfig{
+					HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+						handshakeHostKey = key
+						return nil
+					},
+				}
 			})
 
 			It("generates one internally", func() {
@@ -267,6 +279,38 @@ var _ = Describe("SSH daemon", func() {
 				Expect(dialErr).NotTo(HaveOccurred())
 			})
 
+			It("generates an ed25519 host key and logs its fingerprint", func() {
+				Expect(dialErr).NotTo(HaveOccurred())
+				Expect(handshakeHostKey.Type()).To(Equal(ssh.KeyAlgoED25519))
+
+				fingerprint := helpers.MD5Fingerprint(handshakeHostKey)
+				Expect(runner).To(gbytes.Say("generated-host-key.*" + fingerprint))
+			})
+
+			Context("and a path for the generated host key is specified", func() {
+				BeforeEach(func() {
+					hostKeyFile, err := ioutil.TempFile("", "host-key")
+					Expect(err).NotTo(HaveOccurred())
+					hostKeyPath = hostKeyFile.Name()
+					Expect(hostKeyFile.Close()).To(Succeed())
+				})
+
+				AfterEach(func() {
+					os.Remove(hostKeyPath)
+				})
+
+				It("writes the generated host key to the path", func() {
+					Expect(dialErr).NotTo(HaveOccurred())
+
+					pemBytes, err := ioutil.ReadFile(hostKeyPath)
+					Expect(err).NotTo(HaveOccurred())
+
+					sshHostKey, err := ssh.ParsePrivateKey(pemBytes)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(sshHostKey.PublicKey().Marshal()).To(Equal(handshakeHostKey.Marshal()))
+				})
+			})
+
 			ItDoesNotExposeSensitiveInformation()
 		})
 
@@ -5,6 +5,7 @@ package main_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/diego-ssh/cmd/sshd/testrunner"
@@ -75,8 +76,12 @@ var _ = Describe("SSH daemon", func() {
 
 		Context("when a client requests the execution of a command", func() {
 			It("runs the command", func() {
-				_, err := client.NewSession()
-				Expect(err).To(MatchError(ContainSubstring("not supported")))
+				session, err := client.NewSession()
+				Expect(err).NotTo(HaveOccurred())
+
+				result, err := session.Output("echo hello")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.TrimSpace(string(result))).To(Equal("hello"))
 			})
 		})
 
@@ -11,6 +11,7 @@ import (
 type Args struct {
 	Address                     string
 	HostKey                     string
+	GeneratedHostKeyPath        string
 	AuthorizedKey               string
 	AllowedCiphers              string
 	AllowedMACs                 string
@@ -23,6 +24,7 @@ func (args Args) ArgSlice() []string {
 	return []string{
 		"-address=" + args.Address,
 		"-hostKey=" + args.HostKey,
+		"-generatedHostKeyPath=" + args.GeneratedHostKeyPath,
 		"-authorizedKey=" + args.AuthorizedKey,
 		"-allowedCiphers=" + args.AllowedCiphers,
 		"-allowedMACs=" + args.AllowedMACs,
@@ -1,7 +1,9 @@
 package daemon
 
 import (
+	"fmt"
 	"net"
+	"sync/atomic"
 
 	"code.cloudfoundry.org/diego-ssh/handlers"
 	"code.cloudfoundry.org/lager"
@@ -13,6 +15,8 @@ type Daemon struct {
 	serverConfig          *ssh.ServerConfig
 	globalRequestHandlers map[string]handlers.GlobalRequestHandler
 	newChannelHandlers    map[string]handlers.NewChannelHandler
+
+	maxSessionsPerConnection int
 }
 
 func New(
@@ -20,12 +24,14 @@ func New(
 	serverConfig *ssh.ServerConfig,
 	globalRequestHandlers map[string]handlers.GlobalRequestHandler,
 	newChannelHandlers map[string]handlers.NewChannelHandler,
+	maxSessionsPerConnection int,
 ) *Daemon {
 	return &Daemon{
-		logger:                logger,
-		serverConfig:          serverConfig,
-		globalRequestHandlers: globalRequestHandlers,
-		newChannelHandlers:    newChannelHandlers,
+		logger:                   logger,
+		serverConfig:             serverConfig,
+		globalRequestHandlers:    globalRequestHandlers,
+		newChannelHandlers:       newChannelHandlers,
+		maxSessionsPerConnection: maxSessionsPerConnection,
 	}
 }
 
@@ -43,7 +49,7 @@ func (d *Daemon) HandleConnection(netConn net.Conn) {
 	}
 
 	go d.handleGlobalRequests(logger, serverRequests)
-	go d.handleNewChannels(logger, serverChannels)
+	go d.handleNewChannels(logger, serverConn, serverChannels)
 
 	serverConn.Wait()
 }
@@ -71,22 +77,40 @@ func (d *Daemon) handleGlobalRequests(logger lager.Logger, requests <-chan *ssh.
 	}
 }
 
-func (d *Daemon) handleNewChannels(logger lager.Logger, newChannelRequests <-chan ssh.NewChannel) {
+func (d *Daemon) handleNewChannels(logger lager.Logger, conn ssh.ConnMetadata, newChannelRequests <-chan ssh.NewChannel) {
 	logger = logger.Session("handle-new-channels")
 	logger.Info("starting")
 	defer logger.Info("finished")
 
+	var sessions int32
+
 	for newChannel := range newChannelRequests {
 		logger.Info("new-channel", lager.Data{
 			"channelType": newChannel.ChannelType(),
 			"extraData":   newChannel.ExtraData(),
 		})
 
-		if handler, ok := d.newChannelHandlers[newChannel.ChannelType()]; ok {
-			go handler.HandleNewChannel(logger, newChannel)
+		handler, ok := d.newChannelHandlers[newChannel.ChannelType()]
+		if !ok {
+			newChannel.Reject(ssh.UnknownChannelType, newChannel.ChannelType())
+			continue
+		}
+
+		if newChannel.ChannelType() != "session" {
+			go handler.HandleNewChannel(logger, handlers.NewChannelWithConnMetadata(newChannel, conn))
+			continue
+		}
+
+		if d.maxSessionsPerConnection > 0 && atomic.LoadInt32(&sessions) >= int32(d.maxSessionsPerConnection) {
+			logger.Info("session-limit-reached", lager.Data{"max-sessions": d.maxSessionsPerConnection})
+			newChannel.Reject(ssh.ResourceShortage, fmt.Sprintf("maximum of %d sessions per connection reached", d.maxSessionsPerConnection))
 			continue
 		}
 
-		newChannel.Reject(ssh.UnknownChannelType, newChannel.ChannelType())
+		atomic.AddInt32(&sessions, 1)
+		go func(handler handlers.NewChannelHandler, newChannel ssh.NewChannel) {
+			defer atomic.AddInt32(&sessions, -1)
+			handler.HandleNewChannel(logger, handlers.NewChannelWithConnMetadata(newChannel, conn))
+		}(handler, newChannel)
 	}
 }
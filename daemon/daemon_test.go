@@ -41,7 +41,7 @@ var _ = Describe("Daemon", func() {
 				fakeConn = &fake_net.FakeConn{}
 				fakeConn.ReadReturns(0, errors.New("oops"))
 
-				sshd = daemon.New(logger, serverSSHConfig, nil, nil)
+				sshd = daemon.New(logger, serverSSHConfig, nil, nil, 0)
 			})
 
 			It("closes the connection", func() {
@@ -77,7 +77,7 @@ var _ = Describe("Daemon", func() {
 					},
 				}
 
-				sshd = daemon.New(logger, serverSSHConfig, nil, nil)
+				sshd = daemon.New(logger, serverSSHConfig, nil, nil, 0)
 				go sshd.HandleConnection(serverNetConn)
 
 				clientConn, clientChannels, clientRequests, clientConnErr = ssh.NewClientConn(clientNetConn, "0.0.0.0", clientConfig)
@@ -114,7 +114,7 @@ var _ = Describe("Daemon", func() {
 
 			serverNetConn, clientNetConn := test_helpers.Pipe()
 
-			sshd = daemon.New(logger, serverSSHConfig, globalRequestHandlers, nil)
+			sshd = daemon.New(logger, serverSSHConfig, globalRequestHandlers, nil, 0)
 			go sshd.HandleConnection(serverNetConn)
 
 			client = test_helpers.NewClient(clientNetConn, nil)
@@ -186,7 +186,7 @@ var _ = Describe("Daemon", func() {
 
 			serverNetConn, clientNetConn := test_helpers.Pipe()
 
-			sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers)
+			sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers, 0)
 			go sshd.HandleConnection(serverNetConn)
 
 			client = test_helpers.NewClient(clientNetConn, nil)
@@ -227,6 +227,15 @@ var _ = Describe("Daemon", func() {
 					Expect(actualChannel.ChannelType()).To(Equal("known-channel-type"))
 					Expect(actualChannel.ExtraData()).To(Equal([]byte("extra-data")))
 				})
+
+				It("associates the connection metadata with the channel", func() {
+					Expect(fakeHandler.HandleNewChannelCallCount()).To(Equal(1))
+
+					_, actualChannel := fakeHandler.HandleNewChannelArgsForCall(0)
+					metadata := handlers.ConnMetadata(actualChannel)
+					Expect(metadata).NotTo(BeNil())
+					Expect(metadata.User()).To(Equal("username"))
+				})
 			})
 
 			Context("and there is not an associated handler", func() {
@@ -246,4 +255,88 @@ var _ = Describe("Daemon", func() {
 			})
 		})
 	})
+
+	Describe("session limits", func() {
+		var (
+			fakeHandler *fake_handlers.FakeNewChannelHandler
+			client      *ssh.Client
+			release     chan struct{}
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+
+			fakeHandler = &fake_handlers.FakeNewChannelHandler{}
+			fakeHandler.HandleNewChannelStub = func(logger lager.Logger, newChannel ssh.NewChannel) {
+				ch, _, err := newChannel.Accept()
+				if err != nil {
+					return
+				}
+				<-release
+				ch.Close()
+			}
+
+			newChannelHandlers := map[string]handlers.NewChannelHandler{
+				"session":      fakeHandler,
+				"direct-tcpip": fakeHandler,
+			}
+
+			serverNetConn, clientNetConn := test_helpers.Pipe()
+
+			sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers, 2)
+			go sshd.HandleConnection(serverNetConn)
+
+			client = test_helpers.NewClient(clientNetConn, nil)
+		})
+
+		AfterEach(func() {
+			close(release)
+			client.Close()
+		})
+
+		It("rejects session channels beyond the limit", func() {
+			_, _, err := client.OpenChannel("session", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = client.OpenChannel("session", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = client.OpenChannel("session", nil)
+			Expect(err).To(HaveOccurred())
+
+			channelError, ok := err.(*ssh.OpenChannelError)
+			Expect(ok).To(BeTrue())
+			Expect(channelError.Reason).To(Equal(ssh.ResourceShortage))
+			Expect(channelError.Message).To(Equal("maximum of 2 sessions per connection reached"))
+		})
+
+		It("does not count other channel types against the limit", func() {
+			for i := 0; i < 3; i++ {
+				_, _, err := client.OpenChannel("direct-tcpip", nil)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			_, _, err := client.OpenChannel("session", nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows new sessions once earlier sessions complete", func() {
+			ch1, _, err := client.OpenChannel("session", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = client.OpenChannel("session", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			release <- struct{}{}
+			ch1.Close()
+
+			Eventually(func() error {
+				ch, _, err := client.OpenChannel("session", nil)
+				if err == nil {
+					ch.Close()
+				}
+				return err
+			}).ShouldNot(HaveOccurred())
+		})
+	})
 })
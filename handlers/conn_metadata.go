@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ClientAddressRequest is sent by the proxy on session channels to convey
+// the address of the client that connected to the proxy.
+const ClientAddressRequest = "client-address@cloudfoundry.org"
+
+type ClientAddressMsg struct {
+	Address string
+}
+
+type connMetadataNewChannel struct {
+	ssh.NewChannel
+	metadata ssh.ConnMetadata
+}
+
+// NewChannelWithConnMetadata associates a new channel with the metadata of
+// the connection it was opened on.
+func NewChannelWithConnMetadata(newChannel ssh.NewChannel, metadata ssh.ConnMetadata) ssh.NewChannel {
+	return &connMetadataNewChannel{
+		NewChannel: newChannel,
+		metadata:   metadata,
+	}
+}
+
+// ConnMetadata returns the connection metadata associated with a new channel
+// or nil when there is none.
+func ConnMetadata(newChannel ssh.NewChannel) ssh.ConnMetadata {
+	if c, ok := newChannel.(*connMetadataNewChannel); ok {
+		return c.metadata
+	}
+	return nil
+}
+
+// sshConnectionEnvironment returns the SSH_CLIENT and SSH_CONNECTION
+// variables describing the connection. The client address, when present,
+// takes the place of the remote address of the connection.
+func sshConnectionEnvironment(metadata ssh.ConnMetadata, clientAddress string) []string {
+	if metadata == nil || metadata.LocalAddr() == nil {
+		return nil
+	}
+
+	if clientAddress == "" && metadata.RemoteAddr() != nil {
+		clientAddress = metadata.RemoteAddr().String()
+	}
+
+	clientHost, clientPort, err := net.SplitHostPort(clientAddress)
+	if err != nil {
+		return nil
+	}
+
+	localHost, localPort, err := net.SplitHostPort(metadata.LocalAddr().String())
+	if err != nil {
+		return nil
+	}
+
+	return []string{
+		fmt.Sprintf("SSH_CLIENT=%s %s %s", clientHost, clientPort, localPort),
+		fmt.Sprintf("SSH_CONNECTION=%s %s %s %s", clientHost, clientPort, localHost, localPort),
+	}
+}
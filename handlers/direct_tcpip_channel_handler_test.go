@@ -74,7 +74,7 @@ var _ = Describe("DirectTcpipChannelHandler", func() {
 
 		serverNetConn, clientNetConn := test_helpers.Pipe()
 
-		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers)
+		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers, 0)
 		go sshd.HandleConnection(serverNetConn)
 
 		client = test_helpers.NewClient(clientNetConn, nil)
@@ -9,7 +9,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -25,13 +27,21 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// defaultPath is the PATH of commands run in a session unless the client or the
+// daemon's environment overrides it.
+const defaultPath = "/bin:/usr/bin"
+
 var scpRegex = regexp.MustCompile(`^\s*scp($|\s+)`)
+var rsyncServerRegex = regexp.MustCompile(`^\s*rsync\s+--server($|\s+)`)
 
 type SessionChannelHandler struct {
-	runner       Runner
-	shellLocator ShellLocator
-	defaultEnv   map[string]string
-	keepalive    time.Duration
+	runner         Runner
+	shellLocator   ShellLocator
+	defaultEnv     map[string]string
+	keepalive      time.Duration
+	motd           string
+	rsyncPath      string
+	sftpServerPath string
 }
 
 func NewSessionChannelHandler(
@@ -39,12 +49,18 @@ func NewSessionChannelHandler(
 	shellLocator ShellLocator,
 	defaultEnv map[string]string,
 	keepalive time.Duration,
+	motd string,
+	rsyncPath string,
+	sftpServerPath string,
 ) *SessionChannelHandler {
 	return &SessionChannelHandler{
-		runner:       runner,
-		shellLocator: shellLocator,
-		defaultEnv:   defaultEnv,
-		keepalive:    keepalive,
+		runner:         runner,
+		shellLocator:   shellLocator,
+		defaultEnv:     defaultEnv,
+		keepalive:      keepalive,
+		motd:           motd,
+		rsyncPath:      rsyncPath,
+		sftpServerPath: sftpServerPath,
 	}
 }
 
@@ -55,7 +71,7 @@ func (handler *SessionChannelHandler) HandleNewChannel(logger lager.Logger, newC
 		return
 	}
 
-	handler.newSession(logger, channel, handler.keepalive).serviceRequests(requests)
+	handler.newSession(logger, channel, ConnMetadata(newChannel), handler.keepalive).serviceRequests(requests)
 }
 
 type ptyRequestMsg struct {
@@ -73,9 +89,15 @@ type session struct {
 	keepaliveDuration time.Duration
 	keepaliveStopCh   chan struct{}
 
-	shellPath string
-	runner    Runner
-	channel   ssh.Channel
+	shellPath      string
+	motd           string
+	rsyncPath      string
+	sftpServerPath string
+	runner         Runner
+	channel        ssh.Channel
+
+	connMetadata  ssh.ConnMetadata
+	clientAddress string
 
 	sync.Mutex
 	env     map[string]string
@@ -88,13 +110,17 @@ type session struct {
 	ptyMaster *os.File
 }
 
-func (handler *SessionChannelHandler) newSession(logger lager.Logger, channel ssh.Channel, keepalive time.Duration) *session {
+func (handler *SessionChannelHandler) newSession(logger lager.Logger, channel ssh.Channel, connMetadata ssh.ConnMetadata, keepalive time.Duration) *session {
 	return &session{
 		logger:            logger.Session("session-channel"),
 		keepaliveDuration: keepalive,
 		runner:            handler.runner,
 		shellPath:         handler.shellLocator.ShellPath(),
+		motd:              handler.motd,
+		rsyncPath:         handler.rsyncPath,
+		sftpServerPath:    handler.sftpServerPath,
 		channel:           channel,
+		connMetadata:      connMetadata,
 		env:               handler.defaultEnv,
 	}
 }
@@ -123,6 +149,8 @@ func (sess *session) serviceRequests(requests <-chan *ssh.Request) {
 			sess.handleShellRequest(req)
 		case "subsystem":
 			sess.handleSubsystemRequest(req)
+		case ClientAddressRequest:
+			sess.handleClientAddressRequest(req)
 		default:
 			if req.WantReply {
 				req.Reply(false, nil)
@@ -156,6 +184,28 @@ func (sess *session) handleEnvironmentRequest(request *ssh.Request) {
 	}
 }
 
+func (sess *session) handleClientAddressRequest(request *ssh.Request) {
+	logger := sess.logger.Session("handle-client-address-request")
+
+	var clientAddressMessage ClientAddressMsg
+	err := ssh.Unmarshal(request.Payload, &clientAddressMessage)
+	if err != nil {
+		logger.Error("unmarshal-failed", err)
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+		return
+	}
+
+	sess.Lock()
+	sess.clientAddress = clientAddressMessage.Address
+	sess.Unlock()
+
+	if request.WantReply {
+		request.Reply(true, nil)
+	}
+}
+
 func (sess *session) handleSignalRequest(request *ssh.Request) {
 	logger := sess.logger.Session("handle-signal-request")
 
@@ -277,15 +327,93 @@ func (sess *session) handleExecRequest(request *ssh.Request) {
 	if scpRegex.MatchString(execMessage.Command) {
 		logger.Info("handling-scp-command", lager.Data{"Command": execMessage.Command})
 		sess.executeSCP(execMessage.Command, request)
+	} else if rsyncServerRegex.MatchString(execMessage.Command) {
+		logger.Info("handling-rsync-server-command", lager.Data{"Command": execMessage.Command})
+		command, err := sess.rsyncCommand(execMessage.Command)
+		if err != nil {
+			logger.Error("rsync-not-found", err)
+			if request.WantReply {
+				request.Reply(true, nil)
+			}
+			sess.sendExitFailure(logger, err.Error(), 127)
+			sess.destroy()
+			return
+		}
+		sess.executeShell(request, "-c", command)
 	} else {
 		sess.executeShell(request, "-c", execMessage.Command)
 	}
 }
 
+// rsyncCommand replaces the rsync program in an rsync server command with the
+// configured rsync binary. When no binary is configured the rsync found on the
+// PATH of the session is used, so a missing rsync is reported to the client
+// rather than by the shell.
+func (sess *session) rsyncCommand(command string) (string, error) {
+	rsyncPath := sess.rsyncPath
+	if rsyncPath == "" {
+		var err error
+		rsyncPath, err = sess.lookPath("rsync")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	args := strings.TrimPrefix(strings.TrimSpace(command), "rsync")
+	return "'" + strings.Replace(rsyncPath, "'", `'\''`, -1) + "'" + args, nil
+}
+
+// lookPath searches the PATH that commands in the session run with for an
+// executable.
+func (sess *session) lookPath(file string) (string, error) {
+	sess.Lock()
+	path, ok := sess.env["PATH"]
+	sess.Unlock()
+
+	if !ok {
+		path = defaultPath
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, file)
+		info, err := os.Stat(candidate)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s is not installed in this container; use scp or sftp instead", file)
+}
+
 func (sess *session) handleShellRequest(request *ssh.Request) {
+	sess.writeMOTD()
 	sess.executeShell(request)
 }
 
+func (sess *session) writeMOTD() {
+	if sess.motd == "" {
+		return
+	}
+
+	motd := sess.motd
+	if !strings.HasSuffix(motd, "\n") {
+		motd += "\n"
+	}
+
+	sess.Lock()
+	allocPty := sess.allocPty
+	sess.Unlock()
+
+	if allocPty {
+		motd = strings.Replace(motd, "\n", "\r\n", -1)
+	}
+
+	_, err := sess.channel.Write([]byte(motd))
+	if err != nil {
+		sess.logger.Error("failed-to-write-motd", err)
+	}
+}
+
 func (sess *session) handleSubsystemRequest(request *ssh.Request) {
 	logger := sess.logger.Session("handle-subsystem-request")
 	logger.Info("starting")
@@ -313,6 +441,14 @@ func (sess *session) handleSubsystemRequest(request *ssh.Request) {
 		return
 	}
 
+	if sess.sftpServerPath != "" {
+		logger.Info("starting-external-server", lager.Data{"path": sess.sftpServerPath})
+		// The sftp protocol is binary, so the server always runs on pipes
+		// even when the client has requested a pty.
+		sess.execute(request, false, sess.sftpServerPath)
+		return
+	}
+
 	lagerWriter := helpers.NewLagerWriter(logger.Session("sftp-server"))
 	sftpServer, err := sftp.NewServer(sess.channel, sess.channel, sftp.WithDebug(lagerWriter))
 	if err != nil {
@@ -338,10 +474,18 @@ func (sess *session) handleSubsystemRequest(request *ssh.Request) {
 }
 
 func (sess *session) executeShell(request *ssh.Request, args ...string) {
-	logger := sess.logger.Session("execute-shell")
+	sess.executeCommand(request, sess.shellPath, args...)
+}
+
+func (sess *session) executeCommand(request *ssh.Request, path string, args ...string) {
+	sess.execute(request, true, path, args...)
+}
+
+func (sess *session) execute(request *ssh.Request, allowPty bool, path string, args ...string) {
+	logger := sess.logger.Session("execute-command")
 
 	sess.Lock()
-	cmd, err := sess.createCommand(args...)
+	cmd, err := sess.createCommand(path, args...)
 	if err != nil {
 		sess.Unlock()
 		logger.Error("failed-to-create-command", err)
@@ -355,7 +499,7 @@ func (sess *session) executeShell(request *ssh.Request, args ...string) {
 		request.Reply(true, nil)
 	}
 
-	if sess.allocPty {
+	if allowPty && sess.allocPty {
 		err = sess.runWithPty(cmd)
 	} else {
 		err = sess.run(cmd)
@@ -376,12 +520,12 @@ func (sess *session) executeShell(request *ssh.Request, args ...string) {
 	}()
 }
 
-func (sess *session) createCommand(args ...string) (*exec.Cmd, error) {
+func (sess *session) createCommand(path string, args ...string) (*exec.Cmd, error) {
 	if sess.command != nil {
 		return nil, errors.New("command already started")
 	}
 
-	cmd := exec.Command(sess.shellPath, args...)
+	cmd := exec.Command(path, args...)
 	cmd.Env = sess.environment()
 	sess.command = cmd
 
@@ -391,7 +535,7 @@ func (sess *session) createCommand(args ...string) (*exec.Cmd, error) {
 func (sess *session) environment() []string {
 	env := []string{}
 
-	env = append(env, "PATH=/bin:/usr/bin")
+	env = append(env, "PATH="+defaultPath)
 	env = append(env, "LANG=en_US.UTF8")
 
 	for k, v := range sess.env {
@@ -402,6 +546,7 @@ func (sess *session) environment() []string {
 
 	env = append(env, fmt.Sprintf("HOME=%s", os.Getenv("HOME")))
 	env = append(env, fmt.Sprintf("USER=%s", os.Getenv("USER")))
+	env = append(env, sshConnectionEnvironment(sess.connMetadata, sess.clientAddress)...)
 
 	return env
 }
@@ -436,11 +581,7 @@ func (sess *session) sendExitMessage(err error) {
 
 	exitError, ok := err.(*exec.ExitError)
 	if !ok {
-		exitMessage := exitStatusMsg{Status: 255}
-		_, sendErr := sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitMessage))
-		if sendErr != nil {
-			logger.Error("send-exit-status-failed", sendErr)
-		}
+		sess.sendExitFailure(logger, err.Error(), 255)
 		return
 	}
 
@@ -455,8 +596,21 @@ func (sess *session) sendExitMessage(err error) {
 	}
 
 	if waitStatus.Signaled() {
+		signalName := string(signals.SSHSignals[waitStatus.Signal()])
+
+		// An exit-signal message must name the signal, so signals without an
+		// SSH name are reported as an exit status the way shells do.
+		if signalName == "" {
+			exitMessage := exitStatusMsg{Status: 128 + uint32(waitStatus.Signal())}
+			_, sendErr := sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitMessage))
+			if sendErr != nil {
+				logger.Error("send-exit-status-failed", sendErr)
+			}
+			return
+		}
+
 		exitMessage := exitSignalMsg{
-			Signal:     string(signals.SSHSignals[waitStatus.Signal()]),
+			Signal:     signalName,
 			CoreDumped: waitStatus.CoreDump(),
 		}
 		_, sendErr := sess.channel.SendRequest("exit-signal", false, ssh.Marshal(exitMessage))
@@ -473,6 +627,22 @@ func (sess *session) sendExitMessage(err error) {
 	}
 }
 
+// sendExitFailure reports a command that could not be started. The reason is
+// written to the client's stderr because exit-signal messages may only be
+// sent for processes that were terminated by a signal.
+func (sess *session) sendExitFailure(logger lager.Logger, reason string, status uint32) {
+	_, err := fmt.Fprintln(sess.channel.Stderr(), reason)
+	if err != nil {
+		logger.Error("write-exit-failure-failed", err)
+	}
+
+	exitMessage := exitStatusMsg{Status: status}
+	_, sendErr := sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitMessage))
+	if sendErr != nil {
+		logger.Error("send-exit-status-failed", sendErr)
+	}
+}
+
 func setWindowSize(logger lager.Logger, pseudoTty *os.File, columns, rows uint32) error {
 	logger.Info("new-size", lager.Data{"columns": columns, "rows": rows})
 	return term.SetWinsize(pseudoTty.Fd(), &term.Winsize{
@@ -562,6 +732,8 @@ func (sess *session) runWithPty(command *exec.Cmd) error {
 	sess.ptyMaster = ptyMaster
 	defer ptySlave.Close()
 
+	command.Env = append(command.Env, fmt.Sprintf("SSH_TTY=%s", ptySlave.Name()))
+
 	command.Stdout = ptySlave
 	command.Stdin = ptySlave
 	command.Stderr = ptySlave
@@ -63,7 +63,7 @@ var _ = Describe("SessionChannelHandler", func() {
 		defaultEnv = map[string]string{}
 		defaultEnv["TEST"] = "FOO"
 
-		sessionChannelHandler = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second)
+		sessionChannelHandler = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second, "", "", "")
 
 		newChannelHandlers = map[string]handlers.NewChannelHandler{
 			"session": sessionChannelHandler,
@@ -71,7 +71,7 @@ var _ = Describe("SessionChannelHandler", func() {
 
 		serverNetConn, clientNetConn := test_helpers.Pipe()
 
-		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers)
+		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers, 0)
 		connectionFinished = make(chan struct{})
 		go func() {
 			sshd.HandleConnection(serverNetConn)
@@ -289,6 +289,55 @@ var _ = Describe("SessionChannelHandler", func() {
 			})
 		})
 
+		Context("when the command cannot be found", func() {
+			It("forwards the shell's exit status and error output", func() {
+				stderr := &bytes.Buffer{}
+				session.Stderr = stderr
+
+				err := session.Run("/does/not/exist")
+				Expect(err).To(HaveOccurred())
+
+				exitErr, ok := err.(*ssh.ExitError)
+				Expect(ok).To(BeTrue())
+				Expect(exitErr.ExitStatus()).To(Equal(127))
+				Expect(exitErr.Signal()).To(BeEmpty())
+				Expect(stderr.String()).To(ContainSubstring("/does/not/exist"))
+				Expect(strings.Count(stderr.String(), "/does/not/exist")).To(Equal(1))
+			})
+		})
+
+		Context("when the command cannot be executed", func() {
+			It("forwards the shell's exit status", func() {
+				err := session.Run("/dev/null")
+				Expect(err).To(HaveOccurred())
+
+				exitErr, ok := err.(*ssh.ExitError)
+				Expect(ok).To(BeTrue())
+				Expect(exitErr.ExitStatus()).To(Equal(126))
+				Expect(exitErr.Signal()).To(BeEmpty())
+			})
+		})
+
+		Context("when the command fails to start", func() {
+			BeforeEach(func() {
+				runner.StartReturns(errors.New("permission denied"))
+			})
+
+			It("reports the start error on stderr without an exit signal", func() {
+				stderr := &bytes.Buffer{}
+				session.Stderr = stderr
+
+				err := session.Run("true")
+				Expect(err).To(HaveOccurred())
+
+				exitErr, ok := err.(*ssh.ExitError)
+				Expect(ok).To(BeTrue())
+				Expect(exitErr.ExitStatus()).To(Equal(255))
+				Expect(exitErr.Signal()).To(BeEmpty())
+				Expect(stderr.String()).To(Equal("permission denied\n"))
+			})
+		})
+
 		Context("when a signal is sent across the session", func() {
 			Context("before a command has been run", func() {
 				BeforeEach(func() {
@@ -380,6 +429,37 @@ var _ = Describe("SessionChannelHandler", func() {
 				Expect(result).To(ContainSubstring(fmt.Sprintf("HOME=%s", os.Getenv("HOME"))))
 				Expect(result).To(ContainSubstring(fmt.Sprintf("USER=%s", os.Getenv("USER"))))
 			})
+
+			It("describes the connection in SSH_CLIENT and SSH_CONNECTION", func() {
+				result, err := session.Output("/usr/bin/env")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(result)).To(MatchRegexp(`SSH_CLIENT=127\.0\.0\.1 \d+ \d+\n`))
+				Expect(string(result)).To(MatchRegexp(`SSH_CONNECTION=127\.0\.0\.1 \d+ 127\.0\.0\.1 \d+\n`))
+			})
+
+			It("does not set SSH_TTY", func() {
+				result, err := session.Output("/usr/bin/env")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result).NotTo(ContainSubstring("SSH_TTY="))
+			})
+		})
+
+		Context("when the proxy provides the client address", func() {
+			BeforeEach(func() {
+				clientAddress := handlers.ClientAddressMsg{Address: "10.0.0.1:5678"}
+				_, err := session.SendRequest(handlers.ClientAddressRequest, true, ssh.Marshal(clientAddress))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uses the client address in SSH_CLIENT and SSH_CONNECTION", func() {
+				result, err := session.Output("/usr/bin/env")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(result)).To(MatchRegexp(`SSH_CLIENT=10\.0\.0\.1 5678 \d+\n`))
+				Expect(string(result)).To(MatchRegexp(`SSH_CONNECTION=10\.0\.0\.1 5678 127\.0\.0\.1 \d+\n`))
+			})
 		})
 
 		Context("when environment variables are requested", func() {
@@ -535,6 +615,13 @@ var _ = Describe("SessionChannelHandler", func() {
 				Eventually(waitCh, 3).Should(Receive(MatchError("signal: hangup")))
 			})
 
+			It("sets SSH_TTY to the terminal device", func() {
+				result, err := session.Output(`/bin/echo -n "$SSH_TTY"`)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(result)).To(HavePrefix("/dev/"))
+			})
+
 			It("should set the terminal type", func() {
 				result, err := session.Output(`/bin/echo -n "$TERM"`)
 				Expect(err).NotTo(HaveOccurred())
@@ -893,6 +980,130 @@ var _ = Describe("SessionChannelHandler", func() {
 		})
 	})
 
+	Context("when a message of the day is configured", func() {
+		var session *ssh.Session
+
+		BeforeEach(func() {
+			newChannelHandlers["session"] = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second, "Authorized use only.", "", "")
+
+			var sessionErr error
+			session, sessionErr = client.NewSession()
+			Expect(sessionErr).NotTo(HaveOccurred())
+		})
+
+		It("writes the message before starting an interactive shell", func() {
+			stdin, err := session.StdinPipe()
+			Expect(err).NotTo(HaveOccurred())
+
+			stdout, err := session.StdoutPipe()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = session.Shell()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = stdin.Write([]byte("/bin/echo -n Hello\nexit\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stdin.Close()).To(Succeed())
+
+			stdoutBytes, err := ioutil.ReadAll(stdout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(stdoutBytes)).To(Equal("Authorized use only.\nHello"))
+		})
+
+		It("does not write the message when a command is executed", func() {
+			result, err := session.Output("/bin/echo -n Hello")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("Hello"))
+		})
+	})
+
+	Context("when an rsync server command is executed", func() {
+		var (
+			session   *ssh.Session
+			rsyncPath string
+			tempDir   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = ioutil.TempDir("", "rsync")
+			Expect(err).NotTo(HaveOccurred())
+
+			rsyncPath = filepath.Join(tempDir, "fake rsync")
+			err = ioutil.WriteFile(rsyncPath, []byte("#!/bin/sh\n/bin/echo -n \"fake-rsync $@\"\n"), 0755)
+			Expect(err).NotTo(HaveOccurred())
+
+			newChannelHandlers["session"] = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second, "", rsyncPath, "")
+
+			var sessionErr error
+			session, sessionErr = client.NewSession()
+			Expect(sessionErr).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+
+		It("runs the configured rsync binary with the client arguments", func() {
+			result, err := session.Output("rsync --server -vlogDtpre.iLsfxC . /tmp/target")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("fake-rsync --server -vlogDtpre.iLsfxC . /tmp/target"))
+		})
+
+		It("does not replace rsync when it is not run in server mode", func() {
+			result, err := session.Output("/bin/echo -n rsync --version")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("rsync --version"))
+		})
+
+		Context("and no rsync binary is configured", func() {
+			BeforeEach(func() {
+				newChannelHandlers["session"] = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second, "", "", "")
+
+				var sessionErr error
+				session, sessionErr = client.NewSession()
+				Expect(sessionErr).NotTo(HaveOccurred())
+			})
+
+			Context("when rsync is on the PATH of the session", func() {
+				BeforeEach(func() {
+					err := os.Rename(rsyncPath, filepath.Join(tempDir, "rsync"))
+					Expect(err).NotTo(HaveOccurred())
+
+					err = session.Setenv("PATH", tempDir)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("runs that rsync with the client arguments", func() {
+					result, err := session.Output("rsync --server -vlogDtpre.iLsfxC . /tmp/target")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(result)).To(Equal("fake-rsync --server -vlogDtpre.iLsfxC . /tmp/target"))
+				})
+			})
+
+			Context("when rsync cannot be found", func() {
+				BeforeEach(func() {
+					err := session.Setenv("PATH", tempDir)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("tells the client that rsync is not installed", func() {
+					stderr := &bytes.Buffer{}
+					session.Stderr = stderr
+
+					err := session.Run("rsync --server -vlogDtpre.iLsfxC . /tmp/target")
+					Expect(err).To(HaveOccurred())
+
+					exitErr, ok := err.(*ssh.ExitError)
+					Expect(ok).To(BeTrue())
+					Expect(exitErr.ExitStatus()).To(Equal(127))
+					Expect(stderr.String()).To(ContainSubstring("rsync is not installed in this container"))
+					Expect(runner.StartCallCount()).To(Equal(0))
+				})
+			})
+		})
+	})
+
 	Context("when the sftp subystem is requested", func() {
 		It("accepts the request", func() {
 			type subsysMsg struct{ Subsystem string }
@@ -949,6 +1160,73 @@ var _ = Describe("SessionChannelHandler", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(os.IsNotExist(err)).To(BeTrue())
 		})
+
+		Context("and an external sftp server is configured", func() {
+			var tempDir string
+
+			BeforeEach(func() {
+				var err error
+				tempDir, err = ioutil.TempDir("", "sftp-server")
+				Expect(err).NotTo(HaveOccurred())
+
+				sftpServerPath := filepath.Join(tempDir, "sftp-server")
+				err = ioutil.WriteFile(sftpServerPath, []byte("#!/bin/sh\n/bin/echo -n \"sftp-server $TEST\"\nif [ -t 0 ]; then /bin/echo -n \" on a tty\"; fi\n"), 0755)
+				Expect(err).NotTo(HaveOccurred())
+
+				newChannelHandlers["session"] = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv, time.Second, "", "", sftpServerPath)
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(tempDir)
+			})
+
+			It("runs the external server with the session environment", func() {
+				type subsysMsg struct{ Subsystem string }
+				session, err := client.NewSession()
+				Expect(err).NotTo(HaveOccurred())
+				defer session.Close()
+
+				stdout, err := session.StdoutPipe()
+				Expect(err).NotTo(HaveOccurred())
+
+				accepted, err := session.SendRequest("subsystem", true, ssh.Marshal(subsysMsg{Subsystem: "sftp"}))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(accepted).To(BeTrue())
+
+				output, err := ioutil.ReadAll(stdout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(output)).To(Equal("sftp-server FOO"))
+
+				Expect(runner.StartCallCount()).To(Equal(1))
+				Expect(runner.StartArgsForCall(0).Path).To(Equal(filepath.Join(tempDir, "sftp-server")))
+			})
+
+			Context("when a pty has been requested", func() {
+				It("runs the external server without the pty", func() {
+					type subsysMsg struct{ Subsystem string }
+					session, err := client.NewSession()
+					Expect(err).NotTo(HaveOccurred())
+					defer session.Close()
+
+					err = session.RequestPty("vt100", 43, 80, ssh.TerminalModes{})
+					Expect(err).NotTo(HaveOccurred())
+
+					stdout, err := session.StdoutPipe()
+					Expect(err).NotTo(HaveOccurred())
+
+					accepted, err := session.SendRequest("subsystem", true, ssh.Marshal(subsysMsg{Subsystem: "sftp"}))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(accepted).To(BeTrue())
+
+					output, err := ioutil.ReadAll(stdout)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(output)).To(Equal("sftp-server FOO"))
+
+					Expect(runner.StartCallCount()).To(Equal(1))
+					Expect(runner.StartArgsForCall(0).SysProcAttr).To(BeNil())
+				})
+			})
+		})
 	})
 
 	Describe("invalid session channel requests", func() {
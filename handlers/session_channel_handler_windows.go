@@ -3,22 +3,383 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"code.cloudfoundry.org/diego-ssh/helpers"
+	"code.cloudfoundry.org/diego-ssh/signals"
 	"code.cloudfoundry.org/lager"
 	"golang.org/x/crypto/ssh"
 )
 
+// Windows processes cannot receive signals so any signal requested by the
+// client terminates the process.
+var terminatingSignal = syscall.SIGKILL
+
+// Variables from the daemon's environment that Windows programs need to run.
+var inheritedEnvironment = []string{
+	"COMSPEC",
+	"PATH",
+	"PATHEXT",
+	"SystemDrive",
+	"SystemRoot",
+	"TEMP",
+	"TMP",
+	"USERNAME",
+	"USERPROFILE",
+	"WINDIR",
+}
+
 type SessionChannelHandler struct {
+	runner       Runner
+	shellLocator ShellLocator
+	defaultEnv   map[string]string
 }
 
-func NewSessionChannelHandler() *SessionChannelHandler {
-	return &SessionChannelHandler{}
+func NewSessionChannelHandler(
+	runner Runner,
+	shellLocator ShellLocator,
+	defaultEnv map[string]string,
+) *SessionChannelHandler {
+	return &SessionChannelHandler{
+		runner:       runner,
+		shellLocator: shellLocator,
+		defaultEnv:   defaultEnv,
+	}
 }
 
 func (handler *SessionChannelHandler) HandleNewChannel(logger lager.Logger, newChannel ssh.NewChannel) {
-	err := newChannel.Reject(ssh.Prohibited, "SSH is not supported on windows cells")
+	channel, requests, err := newChannel.Accept()
 	if err != nil {
 		logger.Error("handle-new-session-channel-failed", err)
+		return
+	}
+
+	handler.newSession(logger, channel, ConnMetadata(newChannel)).serviceRequests(requests)
+}
+
+type session struct {
+	logger   lager.Logger
+	complete bool
+
+	shellPath string
+	runner    Runner
+	channel   ssh.Channel
+
+	connMetadata  ssh.ConnMetadata
+	clientAddress string
+
+	sync.Mutex
+	env     map[string]string
+	command *exec.Cmd
+}
+
+func (handler *SessionChannelHandler) newSession(logger lager.Logger, channel ssh.Channel, connMetadata ssh.ConnMetadata) *session {
+	env := map[string]string{}
+	for k, v := range handler.defaultEnv {
+		env[k] = v
+	}
+
+	return &session{
+		logger:       logger.Session("session-channel"),
+		runner:       handler.runner,
+		shellPath:    handler.shellLocator.ShellPath(),
+		channel:      channel,
+		connMetadata: connMetadata,
+		env:          env,
+	}
+}
+
+func (sess *session) serviceRequests(requests <-chan *ssh.Request) {
+	logger := sess.logger
+	logger.Info("starting")
+	defer logger.Info("finished")
+
+	defer sess.destroy()
+
+	for req := range requests {
+		sess.logger.Info("received-request", lager.Data{"type": req.Type})
+		switch req.Type {
+		case "env":
+			sess.handleEnvironmentRequest(req)
+		case "signal":
+			sess.handleSignalRequest(req)
+		case "exec":
+			sess.handleExecRequest(req)
+		case "shell":
+			sess.handleShellRequest(req)
+		case ClientAddressRequest:
+			sess.handleClientAddressRequest(req)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (sess *session) handleEnvironmentRequest(request *ssh.Request) {
+	logger := sess.logger.Session("handle-environment-request")
+
+	type envMsg struct {
+		Name  string
+		Value string
+	}
+	var envMessage envMsg
+
+	err := ssh.Unmarshal(request.Payload, &envMessage)
+	if err != nil {
+		logger.Error("unmarshal-failed", err)
+		request.Reply(false, nil)
+		return
+	}
+
+	sess.Lock()
+	sess.env[envMessage.Name] = envMessage.Value
+	sess.Unlock()
+
+	if request.WantReply {
+		request.Reply(true, nil)
+	}
+}
+
+func (sess *session) handleClientAddressRequest(request *ssh.Request) {
+	logger := sess.logger.Session("handle-client-address-request")
+
+	var clientAddressMessage ClientAddressMsg
+	err := ssh.Unmarshal(request.Payload, &clientAddressMessage)
+	if err != nil {
+		logger.Error("unmarshal-failed", err)
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+		return
+	}
+
+	sess.Lock()
+	sess.clientAddress = clientAddressMessage.Address
+	sess.Unlock()
+
+	if request.WantReply {
+		request.Reply(true, nil)
+	}
+}
+
+func (sess *session) handleSignalRequest(request *ssh.Request) {
+	logger := sess.logger.Session("handle-signal-request")
+
+	type signalMsg struct {
+		Signal string
+	}
+	var signalMessage signalMsg
+
+	err := ssh.Unmarshal(request.Payload, &signalMessage)
+	if err != nil {
+		logger.Error("unmarshal-failed", err)
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+		return
+	}
+
+	sess.Lock()
+	defer sess.Unlock()
+
+	cmd := sess.command
+
+	_, known := signals.SyscallSignals[ssh.Signal(signalMessage.Signal)]
+	if cmd != nil && known {
+		logger.Info("terminating-process", lager.Data{"signal": signalMessage.Signal})
+		err := sess.runner.Signal(cmd, terminatingSignal)
+		if err != nil {
+			logger.Error("process-signal-failed", err)
+		}
+	}
+
+	if request.WantReply {
+		request.Reply(true, nil)
+	}
+}
+
+func (sess *session) handleExecRequest(request *ssh.Request) {
+	logger := sess.logger.Session("handle-exec-request")
+
+	type execMsg struct {
+		Command string
+	}
+	var execMessage execMsg
+
+	err := ssh.Unmarshal(request.Payload, &execMessage)
+	if err != nil {
+		logger.Error("unmarshal-failed", err)
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+		return
+	}
+
+	sess.executeShell(request, execMessage.Command)
+}
+
+func (sess *session) handleShellRequest(request *ssh.Request) {
+	sess.executeShell(request, "")
+}
+
+// executeShell runs the command with the shell or, when the command is empty,
+// starts an interactive shell. Windows does not provide pseudo terminals to
+// the daemon so interactive shells communicate through pipes.
+func (sess *session) executeShell(request *ssh.Request, command string) {
+	logger := sess.logger.Session("execute-shell")
+
+	sess.Lock()
+	cmd, err := sess.createCommand(command)
+	if err != nil {
+		sess.Unlock()
+		logger.Error("failed-to-create-command", err)
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+		return
+	}
+
+	if request.WantReply {
+		request.Reply(true, nil)
+	}
+
+	err = sess.run(cmd)
+
+	sess.Unlock()
+
+	if err != nil {
+		sess.sendExitMessage(err)
+		sess.destroy()
+		return
+	}
+
+	go func() {
+		err := sess.wait(cmd)
+		sess.sendExitMessage(err)
+		sess.destroy()
+	}()
+}
+
+func (sess *session) createCommand(command string) (*exec.Cmd, error) {
+	if sess.command != nil {
+		return nil, errors.New("command already started")
+	}
+
+	cmd := exec.Command(sess.shellPath)
+	if command != "" {
+		// cmd.exe does not follow the argument quoting rules used by
+		// exec.Command so the command line is passed through unmodified.
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			CmdLine: fmt.Sprintf("%s /c %s", syscall.EscapeArg(sess.shellPath), command),
+		}
+	}
+	cmd.Env = sess.environment()
+	sess.command = cmd
+
+	return cmd, nil
+}
+
+func (sess *session) environment() []string {
+	vars := map[string]string{}
+
+	for _, name := range inheritedEnvironment {
+		if value, ok := os.LookupEnv(name); ok {
+			vars[strings.ToUpper(name)] = fmt.Sprintf("%s=%s", name, value)
+		}
+	}
+
+	for k, v := range sess.env {
+		vars[strings.ToUpper(k)] = fmt.Sprintf("%s=%s", k, v)
+	}
+
+	for _, v := range sshConnectionEnvironment(sess.connMetadata, sess.clientAddress) {
+		vars[strings.ToUpper(strings.SplitN(v, "=", 2)[0])] = v
+	}
+
+	env := []string{}
+	for _, v := range vars {
+		env = append(env, v)
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+func (sess *session) run(command *exec.Cmd) error {
+	logger := sess.logger.Session("run")
+
+	command.Stdout = sess.channel
+	command.Stderr = sess.channel.Stderr()
+
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	go helpers.CopyAndClose(logger.Session("to-stdin"), nil, stdin, sess.channel, func() { stdin.Close() })
+
+	return sess.runner.Start(command)
+}
+
+func (sess *session) wait(command *exec.Cmd) error {
+	logger := sess.logger.Session("wait")
+	logger.Info("started")
+	defer logger.Info("done")
+	return sess.runner.Wait(command)
+}
+
+type exitStatusMsg struct {
+	Status uint32
+}
+
+func (sess *session) sendExitMessage(err error) {
+	logger := sess.logger.Session("send-exit-message")
+	logger.Info("started")
+	defer logger.Info("finished")
+
+	exitMessage := exitStatusMsg{}
+
+	if err != nil {
+		logger.Error("building-exit-message-from-error", err)
+		exitMessage.Status = 255
+
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if waitStatus, ok := exitError.Sys().(syscall.WaitStatus); ok {
+				exitMessage.Status = uint32(waitStatus.ExitStatus())
+			}
+		}
 	}
 
-	return
+	_, sendErr := sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitMessage))
+	if sendErr != nil {
+		logger.Error("send-exit-status-failed", sendErr)
+	}
+}
+
+func (sess *session) destroy() {
+	logger := sess.logger.Session("destroy")
+	logger.Info("started")
+	defer logger.Info("done")
+
+	sess.Lock()
+	defer sess.Unlock()
+
+	if sess.complete {
+		return
+	}
+
+	sess.complete = true
+
+	if sess.channel != nil {
+		sess.channel.Close()
+	}
 }
@@ -3,6 +3,10 @@
 package handlers_test
 
 import (
+	"io/ioutil"
+	"strings"
+	"syscall"
+
 	"code.cloudfoundry.org/diego-ssh/daemon"
 	"code.cloudfoundry.org/diego-ssh/handlers"
 	"code.cloudfoundry.org/diego-ssh/handlers/fakes"
@@ -38,10 +42,18 @@ var _ = Describe("SessionChannelHandler", func() {
 		serverSSHConfig.AddHostKey(TestHostKey)
 
 		runner = &fakes.FakeRunner{}
+		realRunner := handlers.NewCommandRunner()
+		runner.StartStub = realRunner.Start
+		runner.WaitStub = realRunner.Wait
+		runner.SignalStub = realRunner.Signal
+
 		shellLocator = &fakes.FakeShellLocator{}
+		shellLocator.ShellPathReturns(handlers.NewShellLocator().ShellPath())
+
 		defaultEnv = map[string]string{}
+		defaultEnv["TEST"] = "FOO"
 
-		sessionChannelHandler = handlers.NewSessionChannelHandler()
+		sessionChannelHandler = handlers.NewSessionChannelHandler(runner, shellLocator, defaultEnv)
 
 		newChannelHandlers = map[string]handlers.NewChannelHandler{
 			"session": sessionChannelHandler,
@@ -49,7 +61,7 @@ var _ = Describe("SessionChannelHandler", func() {
 
 		serverNetConn, clientNetConn := test_helpers.Pipe()
 
-		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers)
+		sshd = daemon.New(logger, serverSSHConfig, nil, newChannelHandlers, 0)
 		connectionFinished = make(chan struct{})
 		go func() {
 			sshd.HandleConnection(serverNetConn)
@@ -68,11 +80,125 @@ var _ = Describe("SessionChannelHandler", func() {
 	})
 
 	Context("when a session is opened", func() {
+		var session *ssh.Session
+
+		BeforeEach(func() {
+			var sessionErr error
+			session, sessionErr = client.NewSession()
+
+			Expect(sessionErr).NotTo(HaveOccurred())
+		})
+
+		It("can use the session to execute a command with stdout and stderr", func() {
+			stdout, err := session.StdoutPipe()
+			Expect(err).NotTo(HaveOccurred())
+
+			stderr, err := session.StderrPipe()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = session.Run("echo Hello& echo Goodbye 1>&2")
+			Expect(err).NotTo(HaveOccurred())
+
+			stdoutBytes, err := ioutil.ReadAll(stdout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(stdoutBytes))).To(Equal("Hello"))
+
+			stderrBytes, err := ioutil.ReadAll(stderr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(stderrBytes))).To(Equal("Goodbye"))
+		})
+
+		It("uses the shell locator to find the shell", func() {
+			err := session.Run("exit 0")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(shellLocator.ShellPathCallCount()).To(Equal(1))
+			Expect(runner.StartCallCount()).To(Equal(1))
+
+			cmd := runner.StartArgsForCall(0)
+			Expect(cmd.Path).To(Equal(handlers.NewShellLocator().ShellPath()))
+		})
+
+		Context("when stdin is provided by the client", func() {
+			BeforeEach(func() {
+				session.Stdin = strings.NewReader("Hello")
+			})
+
+			It("can use the session to execute a command that reads it", func() {
+				result, err := session.Output("findstr Hello")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.TrimSpace(string(result))).To(Equal("Hello"))
+			})
+		})
+
+		Context("when the command exits with a non-zero value", func() {
+			It("it preserve the exit code", func() {
+				err := session.Run("exit 3")
+				Expect(err).To(HaveOccurred())
+
+				exitErr, ok := err.(*ssh.ExitError)
+				Expect(ok).To(BeTrue())
+				Expect(exitErr.ExitStatus()).To(Equal(3))
+			})
+		})
+
+		Context("when a signal is sent across the session", func() {
+			It("terminates the process", func() {
+				stdin, err := session.StdinPipe()
+				Expect(err).NotTo(HaveOccurred())
+				defer stdin.Close()
+
+				err = session.Start("findstr nothing")
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(runner.StartCallCount).Should(Equal(1))
+
+				err = session.Signal(ssh.SIGTERM)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(runner.SignalCallCount).Should(Equal(1))
+				_, signal := runner.SignalArgsForCall(0)
+				Expect(signal).To(Equal(syscall.SIGKILL))
+
+				err = session.Wait()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when environment variables are requested", func() {
+			It("runs the command with the specified environment", func() {
+				err := session.Setenv("ENV1", "value1")
+				Expect(err).NotTo(HaveOccurred())
+
+				result, err := session.Output("echo %ENV1%")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.TrimSpace(string(result))).To(Equal("value1"))
+			})
+
+			It("includes the default environment", func() {
+				result, err := session.Output("echo %TEST%")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.TrimSpace(string(result))).To(Equal("FOO"))
+			})
+		})
+
+		Context("when a pty request is received", func() {
+			It("rejects the request", func() {
+				err := session.RequestPty("vt100", 43, 80, ssh.TerminalModes{})
+				Expect(err).To(HaveOccurred())
+			})
+		})
 
-		It("doesn't accept sessions", func() {
-			_, sessionErr := client.NewSession()
+		Context("after executing a command", func() {
+			BeforeEach(func() {
+				err := session.Run("exit 0")
+				Expect(err).NotTo(HaveOccurred())
+			})
 
-			Expect(sessionErr).To(MatchError(ContainSubstring("not supported on windows")))
+			It("the session is no longer usable", func() {
+				_, err := session.SendRequest("exec", true, ssh.Marshal(struct{ Command string }{Command: "exit 0"}))
+				Expect(err).To(HaveOccurred())
+			})
 		})
 	})
 })
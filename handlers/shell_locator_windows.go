@@ -0,0 +1,28 @@
+// +build windows
+
+package handlers
+
+import (
+	"os"
+	"os/exec"
+)
+
+type shellLocator struct{}
+
+func NewShellLocator() ShellLocator {
+	return &shellLocator{}
+}
+
+func (shellLocator) ShellPath() string {
+	if comspec := os.Getenv("COMSPEC"); comspec != "" {
+		if path, err := exec.LookPath(comspec); err == nil {
+			return path
+		}
+	}
+
+	if path, err := exec.LookPath("cmd.exe"); err == nil {
+		return path
+	}
+
+	return `C:\Windows\System32\cmd.exe`
+}
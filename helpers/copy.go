@@ -3,10 +3,31 @@ package helpers
 import (
 	"io"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 )
 
+const DefaultCopyBufferSize = 32 * 1024
+
+var copyBuffers = newCopyBufferPool(DefaultCopyBufferSize)
+
+func newCopyBufferPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, size)
+			return &buffer
+		},
+	}
+}
+
+// SetCopyBufferSize changes the size of the pooled buffers used by Copy and
+// CopyAndClose. It is not safe to call while copies are in progress and is
+// intended to be called once during start up.
+func SetCopyBufferSize(size int) {
+	copyBuffers = newCopyBufferPool(size)
+}
+
 func Copy(logger lager.Logger, wg *sync.WaitGroup, dest io.Writer, src io.Reader) {
 	logger = logger.Session("copy")
 	logger.Info("started")
@@ -16,12 +37,7 @@ func Copy(logger lager.Logger, wg *sync.WaitGroup, dest io.Writer, src io.Reader
 		}
 	}()
 
-	n, err := io.Copy(dest, src)
-	if err != nil {
-		logger.Error("copy-error", err)
-	}
-
-	logger.Info("completed", lager.Data{"bytes-copied": n})
+	pooledCopy(logger, dest, src)
 }
 
 func CopyAndClose(logger lager.Logger, wg *sync.WaitGroup, dest io.WriteCloser, src io.Reader, closeFunc func()) {
@@ -36,10 +52,26 @@ func CopyAndClose(logger lager.Logger, wg *sync.WaitGroup, dest io.WriteCloser,
 		}
 	}()
 
-	n, err := io.Copy(dest, src)
+	pooledCopy(logger, dest, src)
+}
+
+// readerOnly and writerOnly hide any WriterTo or ReaderFrom implementation of
+// the source and destination, which io.CopyBuffer would otherwise use in place
+// of the pooled buffer.
+type readerOnly struct{ io.Reader }
+type writerOnly struct{ io.Writer }
+
+func pooledCopy(logger lager.Logger, dest io.Writer, src io.Reader) {
+	pool := copyBuffers
+	buffer := pool.Get().(*[]byte)
+	defer pool.Put(buffer)
+
+	startTime := time.Now()
+
+	n, err := io.CopyBuffer(writerOnly{dest}, readerOnly{src}, *buffer)
 	if err != nil {
 		logger.Error("copy-error", err)
 	}
 
-	logger.Info("completed", lager.Data{"bytes-copied": n})
+	logger.Info("completed", lager.Data{"bytes-copied": n, "duration": time.Since(startTime).String()})
 }
@@ -1,21 +1,22 @@
 package helpers_test
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"sync"
 
 	"code.cloudfoundry.org/diego-ssh/helpers"
 	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_io"
-	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Copy", func() {
-	var logger lager.Logger
+	var logger *lagertest.TestLogger
 
 	BeforeEach(func() {
 		logger = lagertest.NewTestLogger("test")
@@ -29,6 +30,9 @@ var _ = Describe("Copy", func() {
 		BeforeEach(func() {
 			reader = strings.NewReader("message")
 			fakeWriter = &fake_io.FakeWriter{}
+			fakeWriter.WriteStub = func(p []byte) (int, error) {
+				return len(p), nil
+			}
 			wg = nil
 		})
 
@@ -41,6 +45,45 @@ var _ = Describe("Copy", func() {
 			Expect(string(fakeWriter.WriteArgsForCall(0))).To(Equal("message"))
 		})
 
+		It("logs the bytes copied and the duration", func() {
+			Expect(logger).To(gbytes.Say(`copy.completed.*"bytes-copied":7,"duration":`))
+		})
+
+		Context("when the copy buffer size is changed", func() {
+			var writes []string
+
+			BeforeEach(func() {
+				helpers.SetCopyBufferSize(2)
+
+				writes = []string{}
+				fakeWriter.WriteStub = func(p []byte) (int, error) {
+					writes = append(writes, string(p))
+					return len(p), nil
+				}
+			})
+
+			AfterEach(func() {
+				helpers.SetCopyBufferSize(helpers.DefaultCopyBufferSize)
+			})
+
+			It("copies with buffers of that size", func() {
+				Expect(writes).To(Equal([]string{"me", "ss", "ag", "e"}))
+			})
+
+			Context("and the destination can read from the source itself", func() {
+				var dest *readerFromWriter
+
+				BeforeEach(func() {
+					dest = &readerFromWriter{}
+				})
+
+				It("still copies with buffers of that size", func() {
+					helpers.Copy(logger, nil, dest, strings.NewReader("message"))
+					Expect(dest.writes).To(Equal([]string{"me", "ss", "ag", "e"}))
+				})
+			})
+		})
+
 		Context("when a wait group is provided", func() {
 			BeforeEach(func() {
 				wg = &sync.WaitGroup{}
@@ -92,3 +135,16 @@ var _ = Describe("Copy", func() {
 		})
 	})
 })
+
+type readerFromWriter struct {
+	writes []string
+}
+
+func (w *readerFromWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *readerFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	return 0, errors.New("ReadFrom should not be used")
+}
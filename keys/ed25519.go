@@ -0,0 +1,74 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+
+	"code.cloudfoundry.org/diego-ssh/helpers"
+	"golang.org/x/crypto/ssh"
+)
+
+// Ed25519KeyPairFactory generates ed25519 key pairs. The key size is fixed so
+// the bits argument to NewKeyPair is ignored.
+var Ed25519KeyPairFactory SSHKeyFactory = &ed25519KeyPairFactory{}
+
+type ed25519KeyPairFactory struct{}
+
+func (f *ed25519KeyPairFactory) NewKeyPair(bits int) (KeyPair, error) {
+	return newEd25519()
+}
+
+type ed25519KeyPair struct {
+	encodedPrivateKey string
+	privateKey        ssh.Signer
+}
+
+func newEd25519() (KeyPair, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPrivateKey := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: nil,
+		Bytes:   der,
+	})
+
+	privateKey, err := ssh.ParsePrivateKey(encodedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ed25519KeyPair{
+		encodedPrivateKey: string(encodedPrivateKey),
+		privateKey:        privateKey,
+	}, nil
+}
+
+func (k *ed25519KeyPair) PrivateKey() ssh.Signer {
+	return k.privateKey
+}
+
+func (k *ed25519KeyPair) PEMEncodedPrivateKey() string {
+	return k.encodedPrivateKey
+}
+
+func (k *ed25519KeyPair) PublicKey() ssh.PublicKey {
+	return k.privateKey.PublicKey()
+}
+
+func (k *ed25519KeyPair) Fingerprint() string {
+	return helpers.MD5Fingerprint(k.PublicKey())
+}
+
+func (k *ed25519KeyPair) AuthorizedKey() string {
+	return string(ssh.MarshalAuthorizedKey(k.PublicKey()))
+}
@@ -0,0 +1,53 @@
+package keys_test
+
+import (
+	"code.cloudfoundry.org/diego-ssh/helpers"
+	"code.cloudfoundry.org/diego-ssh/keys"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ed25519", func() {
+	var keyPair keys.KeyPair
+
+	BeforeEach(func() {
+		var err error
+		keyPair, err = keys.Ed25519KeyPairFactory.NewKeyPair(0)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("PrivateKey", func() {
+		It("returns an ed25519 ssh private key associated with the public key", func() {
+			Expect(keyPair.PrivateKey()).NotTo(BeNil())
+			Expect(keyPair.PrivateKey().PublicKey().Type()).To(Equal(ssh.KeyAlgoED25519))
+			Expect(keyPair.PrivateKey().PublicKey()).To(Equal(keyPair.PublicKey()))
+		})
+	})
+
+	Describe("PEMEncodedPrivateKey", func() {
+		It("correctly represents the private key", func() {
+			privateKey, err := ssh.ParsePrivateKey([]byte(keyPair.PEMEncodedPrivateKey()))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(privateKey.PublicKey().Marshal()).To(Equal(keyPair.PublicKey().Marshal()))
+		})
+	})
+
+	Describe("Fingerprint", func() {
+		It("equals the MD5 fingerprint of the public key", func() {
+			expectedFingerprint := helpers.MD5Fingerprint(keyPair.PublicKey())
+
+			Expect(keyPair.Fingerprint()).To(Equal(expectedFingerprint))
+		})
+	})
+
+	Describe("AuthorizedKey", func() {
+		It("equals the authorized key formatted public key", func() {
+			expectedAuthorizedKey := string(ssh.MarshalAuthorizedKey(keyPair.PublicKey()))
+
+			Expect(keyPair.AuthorizedKey()).To(Equal(expectedAuthorizedKey))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"text/template"
+
+	"code.cloudfoundry.org/lager"
+	"golang.org/x/crypto/ssh"
+)
+
+var bannerUserRegex = regexp.MustCompile(`^([^:]+):([^/]+)/(\d+)$`)
+
+// BannerData is provided to the banner template. The banner is sent before
+// the user has been authenticated so only information that can be derived
+// from the user name is available.
+type BannerData struct {
+	User           string
+	Realm          string
+	Guid           string
+	Index          int
+	ComplianceText string
+}
+
+func NewBannerCallback(
+	logger lager.Logger,
+	bannerTemplate string,
+	complianceText string,
+) (func(ssh.ConnMetadata) string, error) {
+	tmpl, err := template.New("banner").Parse(bannerTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = logger.Session("banner")
+
+	return func(metadata ssh.ConnMetadata) string {
+		data := BannerData{
+			User:           metadata.User(),
+			ComplianceText: complianceText,
+		}
+
+		if match := bannerUserRegex.FindStringSubmatch(metadata.User()); match != nil {
+			data.Realm = match[1]
+			data.Guid = match[2]
+			data.Index, _ = strconv.Atoi(match[3])
+		}
+
+		buffer := &bytes.Buffer{}
+		err := tmpl.Execute(buffer, data)
+		if err != nil {
+			logger.Error("execute-template-failed", err)
+			return ""
+		}
+
+		return buffer.String()
+	}, nil
+}
@@ -0,0 +1,74 @@
+package proxy_test
+
+import (
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/test_helpers/fake_ssh"
+	"code.cloudfoundry.org/lager/lagertest"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("NewBannerCallback", func() {
+	var (
+		logger         *lagertest.TestLogger
+		bannerTemplate string
+		complianceText string
+		metadata       *fake_ssh.FakeConnMetadata
+
+		callback func(ssh.ConnMetadata) string
+		err      error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		bannerTemplate = "Instance {{.Index}} of {{.Guid}} ({{.Realm}})\n{{.ComplianceText}}\n"
+		complianceText = "Authorized use only."
+
+		metadata = &fake_ssh.FakeConnMetadata{}
+		metadata.UserReturns("cf:some-app-guid/2")
+	})
+
+	JustBeforeEach(func() {
+		callback, err = proxy.NewBannerCallback(logger, bannerTemplate, complianceText)
+	})
+
+	It("renders the template with details from the user name", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(callback(metadata)).To(Equal("Instance 2 of some-app-guid (cf)\nAuthorized use only.\n"))
+	})
+
+	Context("when the user name does not identify an instance", func() {
+		BeforeEach(func() {
+			bannerTemplate = "{{.User}}|{{.Guid}}|{{.ComplianceText}}"
+			metadata.UserReturns("someone")
+		})
+
+		It("renders the template without the instance details", func() {
+			Expect(callback(metadata)).To(Equal("someone||Authorized use only."))
+		})
+	})
+
+	Context("when the template cannot be parsed", func() {
+		BeforeEach(func() {
+			bannerTemplate = "{{.Index"
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the template fails to execute", func() {
+		BeforeEach(func() {
+			bannerTemplate = "{{.Missing}}"
+		})
+
+		It("logs the error and returns an empty banner", func() {
+			Expect(callback(metadata)).To(BeEmpty())
+			Expect(logger).To(gbytes.Say("test.banner.execute-template-failed"))
+		})
+	})
+})
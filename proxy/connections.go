@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/cloudfoundry/dropsonde/logs"
+	"golang.org/x/crypto/ssh"
+)
+
+var scpRegex = regexp.MustCompile(`^\s*scp($|\s+)`)
+
+const terminateWriteTimeout = time.Second
+
+// ConnectionInfo describes an active connection through the proxy. Byte
+// counts are measured on the client side of the connection and include the
+// SSH protocol overhead.
+type ConnectionInfo struct {
+	ID             string    `json:"id"`
+	User           string    `json:"user"`
+	RemoteAddress  string    `json:"remote_address"`
+	AppGuid        string    `json:"app_guid,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	BytesReceived  int64     `json:"bytes_received"`
+	BytesSent      int64     `json:"bytes_sent"`
+	ChannelsOpened int64     `json:"channels_opened"`
+	OpenSessions   int       `json:"open_sessions"`
+}
+
+type connection struct {
+	id        string
+	startedAt time.Time
+
+	bytesReceived  int64
+	bytesSent      int64
+	channelsOpened int64
+
+	lock          sync.Mutex
+	user          string
+	remoteAddress string
+	appGuid       string
+	logMessage    *LogMessage
+	sessions      []ssh.Channel
+	closers       []ssh.Conn
+}
+
+func (c *connection) info() ConnectionInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return ConnectionInfo{
+		ID:             c.id,
+		User:           c.user,
+		RemoteAddress:  c.remoteAddress,
+		AppGuid:        c.appGuid,
+		StartedAt:      c.startedAt,
+		BytesReceived:  atomic.LoadInt64(&c.bytesReceived),
+		BytesSent:      atomic.LoadInt64(&c.bytesSent),
+		ChannelsOpened: atomic.LoadInt64(&c.channelsOpened),
+		OpenSessions:   len(c.sessions),
+	}
+}
+
+func (c *connection) channelOpened(channelType string, channel ssh.Channel) {
+	atomic.AddInt64(&c.channelsOpened, 1)
+
+	if channelType == "session" {
+		c.lock.Lock()
+		c.sessions = append(c.sessions, channel)
+		c.lock.Unlock()
+	}
+}
+
+func (c *connection) channelClosed(channelType string, channel ssh.Channel) {
+	if channelType != "session" {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, session := range c.sessions {
+		if session == channel {
+			c.sessions = append(c.sessions[:i:i], c.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *connection) requestReceived(request *ssh.Request) {
+	if c.logMessage == nil || request.Type != "exec" {
+		return
+	}
+
+	var execMessage struct {
+		Command string
+	}
+	err := ssh.Unmarshal(request.Payload, &execMessage)
+	if err != nil || !scpRegex.MatchString(execMessage.Command) {
+		return
+	}
+
+	message := fmt.Sprintf("SCP transfer started by %s on instance %d: %s", c.logMessage.sessionUser(c.user), c.logMessage.Index, strings.TrimSpace(execMessage.Command))
+	logs.SendAppLog(c.logMessage.Guid, message, "SSH", strconv.Itoa(c.logMessage.Index))
+}
+
+func (c *connection) expire(logger lager.Logger, maxSessionDuration time.Duration) {
+	logger.Info("max-session-duration-exceeded", lager.Data{"max-session-duration": maxSessionDuration.String()})
+
+	c.terminate(fmt.Sprintf("Session exceeded the maximum duration of %s and is being terminated.", maxSessionDuration))
+}
+
+// terminate writes message to the stderr of each open session so the user
+// knows why the connection is going away, and then closes the connection.
+// A client that is not reading must not keep the connection open, so the
+// connection is closed once terminateWriteTimeout elapses even if the
+// message has not been written.
+func (c *connection) terminate(message string) {
+	c.lock.Lock()
+	sessions := c.sessions
+	c.lock.Unlock()
+
+	written := make(chan struct{})
+	go func() {
+		for _, session := range sessions {
+			session.Stderr().Write([]byte("\r\n" + message + "\r\n"))
+		}
+		close(written)
+	}()
+
+	select {
+	case <-written:
+	case <-time.After(terminateWriteTimeout):
+	}
+
+	c.close()
+}
+
+func (c *connection) close() {
+	c.lock.Lock()
+	closers := c.closers
+	c.lock.Unlock()
+
+	for _, closer := range closers {
+		closer.Close()
+	}
+}
+
+type countingConn struct {
+	net.Conn
+	connection *connection
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.connection.bytesReceived, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.connection.bytesSent, int64(n))
+	return n, err
+}
+
+func (p *Proxy) Connections() []ConnectionInfo {
+	p.connectionLock.Lock()
+	connections := make([]ConnectionInfo, 0, len(p.connections))
+	for _, conn := range p.connections {
+		connections = append(connections, conn.info())
+	}
+	p.connectionLock.Unlock()
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].StartedAt.Before(connections[j].StartedAt)
+	})
+
+	return connections
+}
+
+func (p *Proxy) CloseConnection(id string) bool {
+	p.connectionLock.Lock()
+	conn, ok := p.connections[id]
+	p.connectionLock.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	conn.close()
+	return true
+}
+
+// CloseAppConnections terminates every connection to instances of the
+// application, writing message to their sessions first. It returns the
+// number of connections that were closed.
+func (p *Proxy) CloseAppConnections(appGuid string, message string) int {
+	p.connectionLock.Lock()
+	connections := []*connection{}
+	for _, conn := range p.connections {
+		if conn.appGuid == appGuid {
+			connections = append(connections, conn)
+		}
+	}
+	p.connectionLock.Unlock()
+
+	wg := sync.WaitGroup{}
+	for _, conn := range connections {
+		wg.Add(1)
+		go func(conn *connection) {
+			defer wg.Done()
+			conn.terminate(message)
+		}(conn)
+	}
+	wg.Wait()
+
+	return len(connections)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/rata"
+)
+
+//go:generate counterfeiter -o fakes/fake_connection_manager.go . ConnectionManager
+type ConnectionManager interface {
+	Connections() []ConnectionInfo
+	CloseConnection(id string) bool
+}
+
+type listConnectionsHandler struct {
+	logger  lager.Logger
+	manager ConnectionManager
+}
+
+type closeConnectionHandler struct {
+	logger  lager.Logger
+	manager ConnectionManager
+}
+
+// NewConnectionsHandler returns a handler that lists the active connections
+// and closes individual connections on request. It is intended to be served
+// from the debug address.
+func NewConnectionsHandler(logger lager.Logger, manager ConnectionManager) http.Handler {
+	routes := rata.Routes{
+		{Name: "ListConnections", Method: "GET", Path: "/connections"},
+		{Name: "CloseConnection", Method: "DELETE", Path: "/connections/:id"},
+	}
+
+	logger = logger.Session("connections-handler")
+
+	actions := map[string]http.Handler{
+		"ListConnections": &listConnectionsHandler{logger: logger, manager: manager},
+		"CloseConnection": &closeConnectionHandler{logger: logger, manager: manager},
+	}
+
+	handler, err := rata.NewRouter(routes, actions)
+	if err != nil {
+		panic(err)
+	}
+
+	return handler
+}
+
+func (h *listConnectionsHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(writer).Encode(h.manager.Connections())
+	if err != nil {
+		h.logger.Error("failed-to-encode-connections", err)
+	}
+}
+
+func (h *closeConnectionHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	id := rata.Param(request, "id")
+
+	if !h.manager.CloseConnection(id) {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h.logger.Info("closed-connection", lager.Data{"id": id})
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+	"code.cloudfoundry.org/diego-ssh/proxy/fakes"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConnectionsHandler", func() {
+	var (
+		manager  *fakes.FakeConnectionManager
+		handler  http.Handler
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		manager = &fakes.FakeConnectionManager{}
+		handler = proxy.NewConnectionsHandler(lagertest.NewTestLogger("test"), manager)
+		recorder = httptest.NewRecorder()
+	})
+
+	Describe("GET /connections", func() {
+		var startedAt time.Time
+
+		BeforeEach(func() {
+			startedAt = time.Unix(1000, 0).UTC()
+			manager.ConnectionsReturns([]proxy.ConnectionInfo{{
+				ID:             "1",
+				User:           "cf:app-guid/0",
+				RemoteAddress:  "1.2.3.4:5678",
+				AppGuid:        "app-guid",
+				StartedAt:      startedAt,
+				BytesReceived:  10,
+				BytesSent:      20,
+				ChannelsOpened: 2,
+			}})
+
+			request, err := http.NewRequest("GET", "/connections", nil)
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(recorder, request)
+		})
+
+		It("returns the active connections", func() {
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var connections []proxy.ConnectionInfo
+			err := json.Unmarshal(recorder.Body.Bytes(), &connections)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(connections).To(HaveLen(1))
+			Expect(connections[0].ID).To(Equal("1"))
+			Expect(connections[0].User).To(Equal("cf:app-guid/0"))
+			Expect(connections[0].StartedAt).To(BeTemporally("==", startedAt))
+			Expect(connections[0].BytesSent).To(BeEquivalentTo(20))
+			Expect(connections[0].ChannelsOpened).To(BeEquivalentTo(2))
+		})
+	})
+
+	Describe("DELETE /connections/:id", func() {
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("DELETE", "/connections/42", nil)
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(recorder, request)
+		})
+
+		Context("when the connection exists", func() {
+			BeforeEach(func() {
+				manager.CloseConnectionReturns(true)
+			})
+
+			It("closes the connection", func() {
+				Expect(manager.CloseConnectionCallCount()).To(Equal(1))
+				Expect(manager.CloseConnectionArgsForCall(0)).To(Equal("42"))
+				Expect(recorder.Code).To(Equal(http.StatusNoContent))
+			})
+		})
+
+		Context("when the connection does not exist", func() {
+			BeforeEach(func() {
+				manager.CloseConnectionReturns(false)
+			})
+
+			It("returns not found", func() {
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,109 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/diego-ssh/proxy"
+)
+
+type FakeConnectionManager struct {
+	ConnectionsStub        func() []proxy.ConnectionInfo
+	connectionsMutex       sync.RWMutex
+	connectionsArgsForCall []struct{}
+	connectionsReturns     struct {
+		result1 []proxy.ConnectionInfo
+	}
+	CloseConnectionStub        func(id string) bool
+	closeConnectionMutex       sync.RWMutex
+	closeConnectionArgsForCall []struct {
+		id string
+	}
+	closeConnectionReturns struct {
+		result1 bool
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeConnectionManager) Connections() []proxy.ConnectionInfo {
+	fake.connectionsMutex.Lock()
+	fake.connectionsArgsForCall = append(fake.connectionsArgsForCall, struct{}{})
+	fake.recordInvocation("Connections", []interface{}{})
+	fake.connectionsMutex.Unlock()
+	if fake.ConnectionsStub != nil {
+		return fake.ConnectionsStub()
+	} else {
+		return fake.connectionsReturns.result1
+	}
+}
+
+func (fake *FakeConnectionManager) ConnectionsCallCount() int {
+	fake.connectionsMutex.RLock()
+	defer fake.connectionsMutex.RUnlock()
+	return len(fake.connectionsArgsForCall)
+}
+
+func (fake *FakeConnectionManager) ConnectionsReturns(result1 []proxy.ConnectionInfo) {
+	fake.ConnectionsStub = nil
+	fake.connectionsReturns = struct {
+		result1 []proxy.ConnectionInfo
+	}{result1}
+}
+
+func (fake *FakeConnectionManager) CloseConnection(id string) bool {
+	fake.closeConnectionMutex.Lock()
+	fake.closeConnectionArgsForCall = append(fake.closeConnectionArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("CloseConnection", []interface{}{id})
+	fake.closeConnectionMutex.Unlock()
+	if fake.CloseConnectionStub != nil {
+		return fake.CloseConnectionStub(id)
+	} else {
+		return fake.closeConnectionReturns.result1
+	}
+}
+
+func (fake *FakeConnectionManager) CloseConnectionCallCount() int {
+	fake.closeConnectionMutex.RLock()
+	defer fake.closeConnectionMutex.RUnlock()
+	return len(fake.closeConnectionArgsForCall)
+}
+
+func (fake *FakeConnectionManager) CloseConnectionArgsForCall(i int) string {
+	fake.closeConnectionMutex.RLock()
+	defer fake.closeConnectionMutex.RUnlock()
+	return fake.closeConnectionArgsForCall[i].id
+}
+
+func (fake *FakeConnectionManager) CloseConnectionReturns(result1 bool) {
+	fake.CloseConnectionStub = nil
+	fake.closeConnectionReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeConnectionManager) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.connectionsMutex.RLock()
+	defer fake.connectionsMutex.RUnlock()
+	fake.closeConnectionMutex.RLock()
+	defer fake.closeConnectionMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeConnectionManager) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ proxy.ConnectionManager = new(FakeConnectionManager)
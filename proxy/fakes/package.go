@@ -0,0 +1 @@
+package fakes // import "code.cloudfoundry.org/diego-ssh/proxy/fakes"
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"runtime/debug"
 	"strconv"
 	"sync"
+	"time"
 	"unicode/utf8"
 
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/diego-ssh/handlers"
 	"code.cloudfoundry.org/diego-ssh/helpers"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/runtimeschema/metric"
@@ -18,8 +23,11 @@ import (
 
 const (
 	sshConnections = metric.Metric("ssh-connections")
+	proxyPanics    = metric.Counter("ssh-proxy-panics")
 )
 
+const rejectChannelTimeout = 5 * time.Second
+
 type Waiter interface {
 	Wait() error
 }
@@ -32,28 +40,82 @@ type TargetConfig struct {
 	PrivateKey      string `json:"private_key,omitempty"`
 }
 
+// LogMessage describes the application log lines written for a session. User
+// identifies the person who opened the session, such as the UAA user name of
+// a Cloud Foundry user, rather than the SSH login name.
 type LogMessage struct {
 	Guid    string `json:"guid"`
+	User    string `json:"user,omitempty"`
 	Message string `json:"message"`
 	Index   int    `json:"index"`
 }
 
-type Proxy struct {
-	logger       lager.Logger
-	serverConfig *ssh.ServerConfig
+func (m *LogMessage) sessionUser(loginName string) string {
+	if m.User != "" {
+		return m.User
+	}
+	return loginName
+}
 
-	connectionLock *sync.Mutex
-	connections    int
+type AppMetadata struct {
+	AppGuid          string `json:"app_guid"`
+	AppName          string `json:"app_name"`
+	SpaceGuid        string `json:"space_guid"`
+	SpaceName        string `json:"space_name"`
+	OrganizationGuid string `json:"organization_guid"`
+	OrganizationName string `json:"organization_name"`
+}
+
+func (m *AppMetadata) LagerData() lager.Data {
+	return lager.Data{
+		"app-guid":          m.AppGuid,
+		"app-name":          m.AppName,
+		"space-guid":        m.SpaceGuid,
+		"space-name":        m.SpaceName,
+		"organization-guid": m.OrganizationGuid,
+		"organization-name": m.OrganizationName,
+	}
+}
+
+// Timeouts bound the time spent establishing a proxied connection. A zero
+// value disables the corresponding timeout.
+type Timeouts struct {
+	// Dial bounds the TCP connection to the daemon.
+	Dial time.Duration
+	// Handshake bounds the SSH handshake with the daemon.
+	Handshake time.Duration
+	// ClientHandshake bounds the SSH handshake, including authentication,
+	// with the client.
+	ClientHandshake time.Duration
+}
+
+type Proxy struct {
+	logger             lager.Logger
+	serverConfig       *ssh.ServerConfig
+	maxSessionDuration time.Duration
+	timeouts           Timeouts
+	clock              clock.Clock
+
+	connectionLock   *sync.Mutex
+	connections      map[string]*connection
+	nextConnectionID uint64
 }
 
 func New(
 	logger lager.Logger,
 	serverConfig *ssh.ServerConfig,
+	maxSessionDuration time.Duration,
+	timeouts Timeouts,
+	clock clock.Clock,
 ) *Proxy {
 	return &Proxy{
-		logger:         logger,
-		serverConfig:   serverConfig,
-		connectionLock: &sync.Mutex{},
+		logger:             logger,
+		serverConfig:       serverConfig,
+		maxSessionDuration: maxSessionDuration,
+		timeouts:           timeouts,
+		clock:              clock,
+		connectionLock:     &sync.Mutex{},
+		connections:        map[string]*connection{},
 	}
 }
 
@@ -61,22 +123,53 @@ func (p *Proxy) HandleConnection(netConn net.Conn) {
 	logger := p.logger.Session("handle-connection")
 	defer netConn.Close()
 
-	serverConn, serverChannels, serverRequests, err := ssh.NewServerConn(netConn, p.serverConfig)
+	conn := &connection{startedAt: p.clock.Now()}
+
+	if p.timeouts.ClientHandshake > 0 {
+		netConn.SetDeadline(time.Now().Add(p.timeouts.ClientHandshake))
+	}
+
+	serverConn, serverChannels, serverRequests, err := ssh.NewServerConn(&countingConn{Conn: netConn, connection: conn}, p.serverConfig)
 	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			logger.Error("client-handshake-timed-out", err)
+		}
 		return
 	}
 	defer serverConn.Close()
 
-	clientConn, clientChannels, clientRequests, err := NewClientConn(logger, serverConn.Permissions)
+	netConn.SetDeadline(time.Time{})
+
+	if serverConn.Permissions != nil && serverConn.Permissions.CriticalOptions["health-check"] == "true" {
+		logger.Info("health-check-completed", lager.Data{"user": serverConn.User()})
+		return
+	}
+
+	appMetadata := extractAppMetadata(logger, serverConn.Permissions)
+	if appMetadata != nil {
+		logger = logger.WithData(appMetadata.LagerData())
+		conn.appGuid = appMetadata.AppGuid
+	}
+
+	clientConn, clientChannels, clientRequests, err := NewClientConn(logger, serverConn.Permissions, p.timeouts.Dial, p.timeouts.Handshake)
 	if err != nil {
+		netConn.SetDeadline(time.Now().Add(rejectChannelTimeout))
+		rejectChannels(logger, serverChannels, serverRequests, err)
 		return
 	}
 
+	conn.user = serverConn.User()
+	if remoteAddr := serverConn.RemoteAddr(); remoteAddr != nil {
+		conn.remoteAddress = remoteAddr.String()
+	}
+	conn.closers = []ssh.Conn{serverConn, clientConn}
+
 	logMessage := extractLogMessage(logger, serverConn.Permissions)
+	conn.logMessage = logMessage
 
 	defer func() {
 		if logMessage != nil {
-			endMessage := fmt.Sprintf("Remote access ended for %s", serverConn.RemoteAddr().String())
+			endMessage := fmt.Sprintf("SSH session closed by %s on instance %d from %s", logMessage.sessionUser(serverConn.User()), logMessage.Index, serverConn.RemoteAddr().String())
 			logs.SendAppLog(logMessage.Guid, endMessage, "SSH", strconv.Itoa(logMessage.Index))
 		}
 		clientConn.Close()
@@ -89,31 +182,73 @@ func (p *Proxy) HandleConnection(netConn net.Conn) {
 	fromClientLogger := logger.Session("from-client")
 	fromDaemonLogger := logger.Session("from-daemon")
 
-	go ProxyGlobalRequests(fromClientLogger, clientConn, serverRequests)
-	go ProxyGlobalRequests(fromDaemonLogger, serverConn, clientRequests)
+	go guard(fromClientLogger, func() {
+		ProxyGlobalRequests(fromClientLogger, clientConn, serverRequests)
+	}, serverConn, clientConn)
+	go guard(fromDaemonLogger, func() {
+		ProxyGlobalRequests(fromDaemonLogger, serverConn, clientRequests)
+	}, serverConn, clientConn)
 
-	go ProxyChannels(fromClientLogger, clientConn, serverChannels)
-	go ProxyChannels(fromDaemonLogger, serverConn, clientChannels)
+	go guard(fromClientLogger, func() {
+		proxyChannels(fromClientLogger, clientConn, serverChannels, conn)
+	}, serverConn, clientConn)
+	go guard(fromDaemonLogger, func() {
+		ProxyChannels(fromDaemonLogger, serverConn, clientChannels)
+	}, serverConn, clientConn)
 
 	p.connectionLock.Lock()
-	p.connections++
-	err = sshConnections.Send(p.connections)
+	p.nextConnectionID++
+	conn.id = strconv.FormatUint(p.nextConnectionID, 10)
+	p.connections[conn.id] = conn
+	err = sshConnections.Send(len(p.connections))
 	if err != nil {
 		logger.Error("failed-to-send-ssh-connections-metric", err)
 	}
 	p.connectionLock.Unlock()
 
+	auditData := lager.Data{"user": conn.user, "remote-address": conn.remoteAddress}
+	logger.Info("audit-session-opened", auditData)
+
 	defer func() {
-		p.emitConnectionClosing(logger)
+		p.emitConnectionClosing(logger, conn)
+		auditData["duration"] = p.clock.Since(conn.startedAt).String()
+		logger.Info("audit-session-closed", auditData)
 	}()
 
+	if p.maxSessionDuration > 0 {
+		timer := p.clock.AfterFunc(p.maxSessionDuration, func() {
+			conn.expire(logger, p.maxSessionDuration)
+		})
+		defer timer.Stop()
+	}
+
 	Wait(logger, serverConn, clientConn)
 }
 
-func (p *Proxy) emitConnectionClosing(logger lager.Logger) {
+// rejectChannels reports a failure to reach the daemon to the client by
+// rejecting the first channel it opens. Clients that do not open a channel
+// within rejectChannelTimeout are disconnected without an explanation.
+func rejectChannels(logger lager.Logger, channels <-chan ssh.NewChannel, requests <-chan *ssh.Request, cause error) {
+	go ssh.DiscardRequests(requests)
+
+	select {
+	case newChannel, ok := <-channels:
+		if !ok {
+			return
+		}
+
+		err := newChannel.Reject(ssh.ConnectionFailed, fmt.Sprintf("failed to connect to the application instance: %s", cause))
+		if err != nil {
+			logger.Error("reject-channel-failed", err)
+		}
+	case <-time.After(rejectChannelTimeout):
+	}
+}
+
+func (p *Proxy) emitConnectionClosing(logger lager.Logger, conn *connection) {
 	p.connectionLock.Lock()
-	p.connections--
-	err := sshConnections.Send(p.connections)
+	delete(p.connections, conn.id)
+	err := sshConnections.Send(len(p.connections))
 	p.connectionLock.Unlock()
 
 	if err != nil {
@@ -121,6 +256,31 @@ func (p *Proxy) emitConnectionClosing(logger lager.Logger) {
 	}
 }
 
+// guard runs f and recovers from any panic it raises so that a single
+// misbehaving connection or channel cannot take down the proxy. When a panic
+// is recovered the provided closers are closed to tear down the connection or
+// channel.
+func guard(logger lager.Logger, f func(), closers ...io.Closer) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("recovered-from-panic", fmt.Errorf("%v", r), lager.Data{
+				"stack": string(debug.Stack()),
+			})
+
+			err := proxyPanics.Increment()
+			if err != nil {
+				logger.Error("failed-to-send-ssh-proxy-panics-metric", err)
+			}
+
+			for _, closer := range closers {
+				closer.Close()
+			}
+		}
+	}()
+
+	f()
+}
+
 func extractLogMessage(logger lager.Logger, perms *ssh.Permissions) *LogMessage {
 	logMessageJson := perms.CriticalOptions["log-message"]
 	if logMessageJson == "" {
@@ -137,6 +297,26 @@ func extractLogMessage(logger lager.Logger, perms *ssh.Permissions) *LogMessage
 	return logMessage
 }
 
+func extractAppMetadata(logger lager.Logger, perms *ssh.Permissions) *AppMetadata {
+	if perms == nil {
+		return nil
+	}
+
+	appMetadataJson := perms.CriticalOptions["app-metadata"]
+	if appMetadataJson == "" {
+		return nil
+	}
+
+	appMetadata := &AppMetadata{}
+	err := json.Unmarshal([]byte(appMetadataJson), appMetadata)
+	if err != nil {
+		logger.Error("json-unmarshal-failed", err)
+		return nil
+	}
+
+	return appMetadata
+}
+
 func ProxyGlobalRequests(logger lager.Logger, conn ssh.Conn, reqs <-chan *ssh.Request) {
 	logger = logger.Session("proxy-global-requests")
 
@@ -163,6 +343,10 @@ func ProxyGlobalRequests(logger lager.Logger, conn ssh.Conn, reqs <-chan *ssh.Re
 }
 
 func ProxyChannels(logger lager.Logger, conn ssh.Conn, channels <-chan ssh.NewChannel) {
+	proxyChannels(logger, conn, channels, nil)
+}
+
+func proxyChannels(logger lager.Logger, conn ssh.Conn, channels <-chan ssh.NewChannel, connection *connection) {
 	logger = logger.Session("proxy-channels")
 
 	logger.Info("started")
@@ -172,11 +356,11 @@ func ProxyChannels(logger lager.Logger, conn ssh.Conn, channels <-chan ssh.NewCh
 	}()
 
 	for newChannel := range channels {
-		handleNewChannel(logger, conn, newChannel)
+		handleNewChannel(logger, conn, newChannel, connection)
 	}
 }
 
-func handleNewChannel(logger lager.Logger, conn ssh.Conn, newChannel ssh.NewChannel) {
+func handleNewChannel(logger lager.Logger, conn ssh.Conn, newChannel ssh.NewChannel, connection *connection) {
 	logger.Info("new-channel", lager.Data{
 		"channelType": newChannel.ChannelType(),
 		"extraData":   newChannel.ExtraData(),
@@ -199,6 +383,18 @@ func handleNewChannel(logger lager.Logger, conn ssh.Conn, newChannel ssh.NewChan
 		return
 	}
 
+	if connection != nil {
+		connection.channelOpened(newChannel.ChannelType(), sourceChan)
+
+		if newChannel.ChannelType() == "session" && connection.remoteAddress != "" {
+			clientAddress := handlers.ClientAddressMsg{Address: connection.remoteAddress}
+			_, err := targetChan.SendRequest(handlers.ClientAddressRequest, false, ssh.Marshal(clientAddress))
+			if err != nil {
+				logger.Error("send-client-address-failed", err)
+			}
+		}
+	}
+
 	toTargetLogger := logger.Session("to-target")
 	toSourceLogger := logger.Session("to-source")
 
@@ -206,26 +402,45 @@ func handleNewChannel(logger lager.Logger, conn ssh.Conn, newChannel ssh.NewChan
 	sourceWg := &sync.WaitGroup{}
 
 	targetWg.Add(2)
-	go helpers.Copy(toTargetLogger.Session("stdout"), targetWg, targetChan, sourceChan)
-	go helpers.Copy(toTargetLogger.Session("stderr"), targetWg, targetChan.Stderr(), sourceChan.Stderr())
-	go func() {
+	go guard(toTargetLogger, func() {
+		helpers.Copy(toTargetLogger.Session("stdout"), targetWg, targetChan, sourceChan)
+	}, sourceChan, targetChan)
+	go guard(toTargetLogger, func() {
+		helpers.Copy(toTargetLogger.Session("stderr"), targetWg, targetChan.Stderr(), sourceChan.Stderr())
+	}, sourceChan, targetChan)
+	go guard(toTargetLogger, func() {
 		targetWg.Wait()
 		targetChan.CloseWrite()
-	}()
+	}, sourceChan, targetChan)
 
 	sourceWg.Add(2)
-	go helpers.Copy(toSourceLogger.Session("stdout"), sourceWg, sourceChan, targetChan)
-	go helpers.Copy(toSourceLogger.Session("stderr"), sourceWg, sourceChan.Stderr(), targetChan.Stderr())
-	go func() {
+	go guard(toSourceLogger, func() {
+		helpers.Copy(toSourceLogger.Session("stdout"), sourceWg, sourceChan, targetChan)
+	}, sourceChan, targetChan)
+	go guard(toSourceLogger, func() {
+		helpers.Copy(toSourceLogger.Session("stderr"), sourceWg, sourceChan.Stderr(), targetChan.Stderr())
+	}, sourceChan, targetChan)
+	go guard(toSourceLogger, func() {
 		sourceWg.Wait()
 		sourceChan.CloseWrite()
-	}()
-
-	go ProxyRequests(toTargetLogger, newChannel.ChannelType(), sourceReqs, targetChan, targetWg)
-	go ProxyRequests(toSourceLogger, newChannel.ChannelType(), targetReqs, sourceChan, sourceWg)
+	}, sourceChan, targetChan)
+
+	go guard(toTargetLogger, func() {
+		proxyRequests(toTargetLogger, newChannel.ChannelType(), sourceReqs, targetChan, targetWg, connection)
+	}, sourceChan, targetChan)
+	go guard(toSourceLogger, func() {
+		if connection != nil {
+			defer connection.channelClosed(newChannel.ChannelType(), sourceChan)
+		}
+		ProxyRequests(toSourceLogger, newChannel.ChannelType(), targetReqs, sourceChan, sourceWg)
+	}, sourceChan, targetChan)
 }
 
 func ProxyRequests(logger lager.Logger, channelType string, reqs <-chan *ssh.Request, channel ssh.Channel, wg *sync.WaitGroup) {
+	proxyRequests(logger, channelType, reqs, channel, wg, nil)
+}
+
+func proxyRequests(logger lager.Logger, channelType string, reqs <-chan *ssh.Request, channel ssh.Channel, wg *sync.WaitGroup, connection *connection) {
 	logger = logger.Session("proxy-requests", lager.Data{
 		"channel-type": channelType,
 	})
@@ -243,6 +458,18 @@ func ProxyRequests(logger lager.Logger, channelType string, reqs <-chan *ssh.Req
 			"wantReply": req.WantReply,
 			"payload":   req.Payload,
 		})
+
+		if connection != nil {
+			if req.Type == handlers.ClientAddressRequest {
+				if req.WantReply {
+					req.Reply(false, nil)
+				}
+				continue
+			}
+
+			connection.requestReceived(req)
+		}
+
 		success, err := channel.SendRequest(req.Type, req.WantReply, req.Payload)
 		if err != nil {
 			logger.Error("send-request-failed", err)
@@ -271,7 +498,12 @@ func Wait(logger lager.Logger, waiters ...Waiter) {
 	wg.Wait()
 }
 
-func NewClientConn(logger lager.Logger, permissions *ssh.Permissions) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+func NewClientConn(
+	logger lager.Logger,
+	permissions *ssh.Permissions,
+	dialTimeout time.Duration,
+	handshakeTimeout time.Duration,
+) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
 	if permissions == nil || permissions.CriticalOptions == nil {
 		err := errors.New("Invalid permissions from authentication")
 		logger.Error("permissions-and-critical-options-required", err)
@@ -290,7 +522,7 @@ func NewClientConn(logger lager.Logger, permissions *ssh.Permissions) (ssh.Conn,
 		return nil, nil, nil, err
 	}
 
-	nConn, err := net.Dial("tcp", targetConfig.Address)
+	nConn, err := net.DialTimeout("tcp", targetConfig.Address, dialTimeout)
 	if err != nil {
 		logger.Error("dial-failed", err)
 		return nil, nil, nil, err
@@ -306,6 +538,7 @@ func NewClientConn(logger lager.Logger, permissions *ssh.Permissions) (ssh.Conn,
 		key, err := ssh.ParsePrivateKey([]byte(targetConfig.PrivateKey))
 		if err != nil {
 			logger.Error("parsing-key-failed", err)
+			nConn.Close()
 			return nil, nil, nil, err
 		}
 		clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(key))
@@ -337,11 +570,18 @@ func NewClientConn(logger lager.Logger, permissions *ssh.Permissions) (ssh.Conn,
 		}
 	}
 
+	if handshakeTimeout > 0 {
+		nConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	}
+
 	conn, ch, req, err := ssh.NewClientConn(nConn, targetConfig.Address, clientConfig)
 	if err != nil {
 		logger.Error("handshake-failed", err)
+		nConn.Close()
 		return nil, nil, nil, err
 	}
 
+	nConn.SetDeadline(time.Time{})
+
 	return conn, ch, req, nil
 }
@@ -3,10 +3,14 @@ package proxy_test
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/diego-ssh/authenticators/fake_authenticators"
 	"code.cloudfoundry.org/diego-ssh/daemon"
 	"code.cloudfoundry.org/diego-ssh/handlers"
@@ -46,6 +50,9 @@ var _ = Describe("Proxy", func() {
 			proxyAuthenticator *fake_authenticators.FakePasswordAuthenticator
 			proxySSHConfig     *ssh.ServerConfig
 			sshProxy           *proxy.Proxy
+			maxSessionDuration time.Duration
+			timeouts           proxy.Timeouts
+			fakeClock          *fakeclock.FakeClock
 
 			daemonTargetConfig          proxy.TargetConfig
 			daemonAuthenticator         *fake_authenticators.FakePasswordAuthenticator
@@ -75,6 +82,9 @@ var _ = Describe("Proxy", func() {
 			logs.Initialize(fakeLogSender)
 
 			proxyAuthenticator = &fake_authenticators.FakePasswordAuthenticator{}
+			maxSessionDuration = 0
+			timeouts = proxy.Timeouts{}
+			fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
 
 			proxySSHConfig = &ssh.ServerConfig{}
 			proxySSHConfig.PasswordCallback = proxyAuthenticator.Authenticate
@@ -110,6 +120,7 @@ var _ = Describe("Proxy", func() {
 
 			logMessageJson, err := json.Marshal(proxy.LogMessage{
 				Guid:    "a-guid",
+				User:    "alice@example.com",
 				Message: "a-message",
 				Index:   1,
 			})
@@ -125,7 +136,7 @@ var _ = Describe("Proxy", func() {
 		})
 
 		JustBeforeEach(func() {
-			sshProxy = proxy.New(logger.Session("proxy"), proxySSHConfig)
+			sshProxy = proxy.New(logger.Session("proxy"), proxySSHConfig, maxSessionDuration, timeouts, fakeClock)
 			proxyServer = server.NewServer(logger.Session("proxy-server"), "", sshProxy)
 			proxyServer.SetListener(proxyListener)
 			go func() {
@@ -133,7 +144,7 @@ var _ = Describe("Proxy", func() {
 				close(proxyDone)
 			}()
 
-			sshDaemon = daemon.New(logger.Session("sshd"), daemonSSHConfig, daemonGlobalRequestHandlers, daemonNewChannelHandlers)
+			sshDaemon = daemon.New(logger.Session("sshd"), daemonSSHConfig, daemonGlobalRequestHandlers, daemonNewChannelHandlers, 0)
 			sshdServer = server.NewServer(logger.Session("sshd-server"), "", sshDaemon)
 			sshdServer.SetListener(sshdListener)
 			go func() {
@@ -188,6 +199,27 @@ var _ = Describe("Proxy", func() {
 				})
 			})
 
+			Context("when the client does not complete the handshake in time", func() {
+				BeforeEach(func() {
+					timeouts.ClientHandshake = 100 * time.Millisecond
+				})
+
+				It("closes the connection", func() {
+					conn, err := net.Dial("tcp", proxyAddress)
+					Expect(err).NotTo(HaveOccurred())
+					defer conn.Close()
+
+					closed := make(chan struct{})
+					go func() {
+						io.Copy(ioutil.Discard, conn)
+						close(closed)
+					}()
+
+					Eventually(closed).Should(BeClosed())
+					Expect(logger).To(gbytes.Say("client-handshake-timed-out"))
+				})
+			})
+
 			Context("when the client handshake is successful", func() {
 				var client *ssh.Client
 
@@ -214,6 +246,37 @@ var _ = Describe("Proxy", func() {
 					Expect(logMessage.Message).To(Equal("a-message"))
 				})
 
+				Context("when the permissions contain app metadata", func() {
+					BeforeEach(func() {
+						targetConfigJson, err := json.Marshal(daemonTargetConfig)
+						Expect(err).NotTo(HaveOccurred())
+
+						appMetadataJson, err := json.Marshal(proxy.AppMetadata{
+							AppGuid:          "app-guid",
+							AppName:          "app-name",
+							SpaceName:        "space-name",
+							OrganizationName: "org-name",
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						permissions := &ssh.Permissions{
+							CriticalOptions: map[string]string{
+								"proxy-target-config": string(targetConfigJson),
+								"app-metadata":        string(appMetadataJson),
+							},
+						}
+						proxyAuthenticator.AuthenticateReturns(permissions, nil)
+					})
+
+					It("includes the metadata in the connection logs", func() {
+						Eventually(logger).Should(gbytes.Say(`"app-name":"app-name".*"organization-name":"org-name".*"space-name":"space-name"`))
+					})
+
+					It("emits an audit event attributed to the application", func() {
+						Eventually(logger).Should(gbytes.Say(`audit-session-opened.*"app-name":"app-name".*"organization-name":"org-name".*"space-name":"space-name".*"user":"diego:some-instance-guid"`))
+					})
+				})
+
 				Context("when the target contains a host fingerprint", func() {
 					Context("when the fingerprint is an md5 hash", func() {
 						BeforeEach(func() {
@@ -303,7 +366,15 @@ var _ = Describe("Proxy", func() {
 						proxyAuthenticator.AuthenticateReturns(permissions, nil)
 					})
 
+					It("rejects the channels opened by the client with the failure", func() {
+						_, err := client.NewSession()
+						Expect(err).To(MatchError(ContainSubstring("failed to connect to the application instance")))
+					})
+
 					It("closes the connection", func() {
+						_, err := client.NewSession()
+						Expect(err).To(HaveOccurred())
+
 						Eventually(client.Wait).Should(Equal(io.EOF))
 					})
 
@@ -312,6 +383,29 @@ var _ = Describe("Proxy", func() {
 					})
 				})
 
+				Context("when the connection is a health check", func() {
+					BeforeEach(func() {
+						permissions := &ssh.Permissions{
+							CriticalOptions: map[string]string{
+								"health-check": "true",
+							},
+						}
+						proxyAuthenticator.AuthenticateReturns(permissions, nil)
+					})
+
+					It("closes the connection", func() {
+						Eventually(client.Wait).Should(Equal(io.EOF))
+					})
+
+					It("does not connect to a daemon", func() {
+						Consistently(daemonAuthenticator.AuthenticateCallCount).Should(Equal(0))
+					})
+
+					It("logs the health check", func() {
+						Eventually(logger).Should(gbytes.Say(`health-check-completed`))
+					})
+				})
+
 				Context("when the handshake fails", func() {
 					BeforeEach(func() {
 						daemonAuthenticator.AuthenticateReturns(nil, errors.New("go away"))
@@ -426,6 +520,56 @@ var _ = Describe("Proxy", func() {
 						Expect(err).To(Equal(&ssh.OpenChannelError{Reason: ssh.Prohibited, Message: "not now"}))
 					})
 				})
+
+				Context("when the client opens a session", func() {
+					var requestTypes chan string
+
+					BeforeEach(func() {
+						requestTypes = make(chan string, 10)
+
+						newChannelHandler := &fake_handlers.FakeNewChannelHandler{}
+						newChannelHandler.HandleNewChannelStub = func(logger lager.Logger, newChannel ssh.NewChannel) {
+							_, requests, err := newChannel.Accept()
+							if err != nil {
+								return
+							}
+
+							for req := range requests {
+								requestTypes <- req.Type
+								if req.Type == handlers.ClientAddressRequest {
+									var msg handlers.ClientAddressMsg
+									ssh.Unmarshal(req.Payload, &msg)
+									requestTypes <- msg.Address
+								}
+								if req.WantReply {
+									req.Reply(true, nil)
+								}
+							}
+						}
+						daemonNewChannelHandlers["session"] = newChannelHandler
+					})
+
+					It("sends the client address to the daemon", func() {
+						_, _, err := client.OpenChannel("session", nil)
+						Expect(err).NotTo(HaveOccurred())
+
+						Eventually(requestTypes).Should(Receive(Equal(handlers.ClientAddressRequest)))
+						Eventually(requestTypes).Should(Receive(Equal(client.LocalAddr().String())))
+					})
+
+					It("does not forward client address requests from the client", func() {
+						channel, _, err := client.OpenChannel("session", nil)
+						Expect(err).NotTo(HaveOccurred())
+
+						Eventually(requestTypes).Should(Receive(Equal(handlers.ClientAddressRequest)))
+						Eventually(requestTypes).Should(Receive())
+
+						accepted, err := channel.SendRequest(handlers.ClientAddressRequest, true, ssh.Marshal(handlers.ClientAddressMsg{Address: "1.2.3.4:5"}))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(accepted).To(BeFalse())
+						Consistently(requestTypes).ShouldNot(Receive())
+					})
+				})
 			})
 
 			Describe("target requests to client", func() {
@@ -614,6 +758,158 @@ var _ = Describe("Proxy", func() {
 				})
 			})
 
+			Describe("connection accounting", func() {
+				var client *ssh.Client
+
+				BeforeEach(func() {
+					daemonNewChannelHandlers["session"] = handlers.NewSessionChannelHandler(
+						handlers.NewCommandRunner(),
+						handlers.NewShellLocator(),
+						map[string]string{},
+						time.Minute,
+						"",
+						"",
+						"",
+					)
+				})
+
+				JustBeforeEach(func() {
+					var err error
+					client, err = ssh.Dial("tcp", proxyAddress, clientConfig)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					client.Close()
+				})
+
+				It("tracks the active connections", func() {
+					session, err := client.NewSession()
+					Expect(err).NotTo(HaveOccurred())
+					_, err = session.Output("true")
+					Expect(err).NotTo(HaveOccurred())
+
+					Eventually(sshProxy.Connections).Should(HaveLen(1))
+					connection := sshProxy.Connections()[0]
+					Expect(connection.User).To(Equal("diego:some-instance-guid"))
+					Expect(connection.RemoteAddress).To(Equal(client.LocalAddr().String()))
+					Expect(connection.StartedAt).To(Equal(fakeClock.Now()))
+					Expect(connection.BytesReceived).To(BeNumerically(">", 0))
+					Expect(connection.BytesSent).To(BeNumerically(">", 0))
+
+					Eventually(func() int64 {
+						return sshProxy.Connections()[0].ChannelsOpened
+					}).Should(BeEquivalentTo(1))
+				})
+
+				It("tracks the sessions that are open", func() {
+					Eventually(sshProxy.Connections).Should(HaveLen(1))
+
+					sessions := []*ssh.Session{}
+					for i := 0; i < 3; i++ {
+						session, err := client.NewSession()
+						Expect(err).NotTo(HaveOccurred())
+						sessions = append(sessions, session)
+					}
+
+					Eventually(func() int {
+						return sshProxy.Connections()[0].OpenSessions
+					}).Should(Equal(3))
+
+					for _, session := range sessions[:2] {
+						session.Close()
+					}
+
+					Eventually(func() int {
+						return sshProxy.Connections()[0].OpenSessions
+					}).Should(Equal(1))
+					Expect(sshProxy.Connections()[0].ChannelsOpened).To(BeEquivalentTo(3))
+				})
+
+				It("stops tracking connections when they are closed", func() {
+					Eventually(sshProxy.Connections).Should(HaveLen(1))
+
+					client.Close()
+					Eventually(sshProxy.Connections).Should(BeEmpty())
+				})
+
+				It("closes connections on request", func() {
+					Eventually(sshProxy.Connections).Should(HaveLen(1))
+
+					Expect(sshProxy.CloseConnection(sshProxy.Connections()[0].ID)).To(BeTrue())
+					Eventually(client.Wait).Should(Equal(io.EOF))
+				})
+
+				It("reports when closing an unknown connection", func() {
+					Expect(sshProxy.CloseConnection("unknown")).To(BeFalse())
+				})
+
+				Context("when the connection is to an application instance", func() {
+					BeforeEach(func() {
+						targetConfigJson, err := json.Marshal(daemonTargetConfig)
+						Expect(err).NotTo(HaveOccurred())
+
+						appMetadataJson, err := json.Marshal(proxy.AppMetadata{AppGuid: "app-guid"})
+						Expect(err).NotTo(HaveOccurred())
+
+						proxyAuthenticator.AuthenticateReturns(&ssh.Permissions{
+							CriticalOptions: map[string]string{
+								"proxy-target-config": string(targetConfigJson),
+								"app-metadata":        string(appMetadataJson),
+							},
+						}, nil)
+					})
+
+					It("closes the application's connections with a message", func() {
+						session, err := client.NewSession()
+						Expect(err).NotTo(HaveOccurred())
+
+						stderr := gbytes.NewBuffer()
+						session.Stderr = stderr
+						stdin, err := session.StdinPipe()
+						Expect(err).NotTo(HaveOccurred())
+						defer stdin.Close()
+						Expect(session.Shell()).To(Succeed())
+
+						Eventually(sshProxy.Connections).Should(HaveLen(1))
+						Eventually(func() int64 {
+							return sshProxy.Connections()[0].ChannelsOpened
+						}).Should(BeEquivalentTo(1))
+
+						Expect(sshProxy.CloseAppConnections("other-app-guid", "go away")).To(Equal(0))
+						Expect(sshProxy.CloseAppConnections("app-guid", "SSH access has been disabled")).To(Equal(1))
+
+						Eventually(stderr).Should(gbytes.Say("SSH access has been disabled"))
+						Eventually(client.Wait).Should(Equal(io.EOF))
+					})
+				})
+
+				Context("when a maximum session duration is configured", func() {
+					BeforeEach(func() {
+						maxSessionDuration = time.Hour
+					})
+
+					It("warns the user and closes the connection when the duration is exceeded", func() {
+						session, err := client.NewSession()
+						Expect(err).NotTo(HaveOccurred())
+
+						stderr := gbytes.NewBuffer()
+						session.Stderr = stderr
+						stdin, err := session.StdinPipe()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(session.Shell()).To(Succeed())
+
+						fakeClock.WaitForWatcherAndIncrement(time.Hour)
+
+						Eventually(stderr).Should(gbytes.Say("Session exceeded the maximum duration of 1h0m0s"))
+						Eventually(client.Wait).Should(Equal(io.EOF))
+						Eventually(logger).Should(gbytes.Say("max-session-duration-exceeded"))
+
+						stdin.Close()
+					})
+				})
+			})
+
 			Describe("app logs", func() {
 				Context("when a connection is closed", func() {
 					It("logs that the connection has been closed", func() {
@@ -630,7 +926,46 @@ var _ = Describe("Proxy", func() {
 								}
 								return fakeLogSender.GetLogs()[lastIdx].Message
 							},
-						).Should(ContainSubstring("Remote access ended for"))
+						).Should(ContainSubstring("SSH session closed by alice@example.com on instance 1 from"))
+					})
+				})
+
+				Context("when the client executes an scp command", func() {
+					BeforeEach(func() {
+						newChannelHandler := &fake_handlers.FakeNewChannelHandler{}
+						newChannelHandler.HandleNewChannelStub = func(logger lager.Logger, newChannel ssh.NewChannel) {
+							channel, requests, err := newChannel.Accept()
+							if err != nil {
+								return
+							}
+
+							for req := range requests {
+								req.Reply(true, nil)
+								if req.Type == "exec" {
+									channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+									channel.Close()
+								}
+							}
+						}
+						daemonNewChannelHandlers["session"] = newChannelHandler
+					})
+
+					It("logs the transfer on behalf of the lrp", func() {
+						client, err := ssh.Dial("tcp", proxyAddress, clientConfig)
+						Expect(err).NotTo(HaveOccurred())
+						defer client.Close()
+
+						session, err := client.NewSession()
+						Expect(err).NotTo(HaveOccurred())
+						session.Run("scp -t /tmp/some-file")
+
+						Eventually(func() []string {
+							messages := []string{}
+							for _, log := range fakeLogSender.GetLogs() {
+								messages = append(messages, log.Message)
+							}
+							return messages
+						}).Should(ContainElement("SCP transfer started by alice@example.com on instance 1: scp -t /tmp/some-file"))
 					})
 				})
 			})
@@ -801,6 +1136,27 @@ var _ = Describe("Proxy", func() {
 					Eventually(newChan.AcceptCallCount).Should(Equal(1))
 				})
 
+				Context("when copying the channel data panics", func() {
+					BeforeEach(func() {
+						sourceChannel.ReadStub = func(dest []byte) (int, error) {
+							panic("boom")
+						}
+					})
+
+					It("recovers and closes the channels", func() {
+						Eventually(logger).Should(gbytes.Say("recovered-from-panic"))
+						Eventually(sourceChannel.CloseCallCount).Should(BeNumerically(">=", 1))
+						Eventually(targetChannel.CloseCallCount).Should(BeNumerically(">=", 1))
+					})
+
+					It("continues to proxy new channels", func() {
+						Eventually(logger).Should(gbytes.Say("recovered-from-panic"))
+
+						newChanChan <- newChan
+						Eventually(targetConn.OpenChannelCallCount).Should(Equal(2))
+					})
+				})
+
 				Context("when the source channel has data available", func() {
 					BeforeEach(func() {
 						sourceChannel.ReadStub = func(dest []byte) (int, error) {
@@ -1121,6 +1477,8 @@ var _ = Describe("Proxy", func() {
 			sshdListener    net.Listener
 			sshdServer      *server.Server
 
+			dialTimeout      time.Duration
+			handshakeTimeout time.Duration
 			newClientConnErr error
 		)
 
@@ -1128,6 +1486,8 @@ var _ = Describe("Proxy", func() {
 			permissions = &ssh.Permissions{
 				CriticalOptions: map[string]string{},
 			}
+			dialTimeout = 0
+			handshakeTimeout = 0
 
 			daemonSSHConfig = &ssh.ServerConfig{}
 			daemonSSHConfig.AddHostKey(TestHostKey)
@@ -1139,12 +1499,12 @@ var _ = Describe("Proxy", func() {
 		})
 
 		JustBeforeEach(func() {
-			sshDaemon = daemon.New(logger.Session("sshd"), daemonSSHConfig, nil, nil)
+			sshDaemon = daemon.New(logger.Session("sshd"), daemonSSHConfig, nil, nil, 0)
 			sshdServer = server.NewServer(logger, "127.0.0.1:0", sshDaemon)
 			sshdServer.SetListener(sshdListener)
 			go sshdServer.Serve()
 
-			_, _, _, newClientConnErr = proxy.NewClientConn(logger, permissions)
+			_, _, _, newClientConnErr = proxy.NewClientConn(logger, permissions, dialTimeout, handshakeTimeout)
 		})
 
 		AfterEach(func() {
@@ -1221,6 +1581,70 @@ var _ = Describe("Proxy", func() {
 			})
 		})
 
+		Context("when the daemon cannot be reached in time", func() {
+			BeforeEach(func() {
+				permissions.CriticalOptions["proxy-target-config"] = `{ "address": "192.0.2.1:22" }`
+				dialTimeout = 100 * time.Millisecond
+			})
+
+			It("returns an error without waiting for the default dial timeout", func() {
+				Expect(newClientConnErr).To(HaveOccurred())
+
+				start := time.Now()
+				_, _, _, err := proxy.NewClientConn(logger, permissions, dialTimeout, handshakeTimeout)
+				Expect(err).To(HaveOccurred())
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			})
+
+			It("logs the failure", func() {
+				Eventually(logger).Should(gbytes.Say("dial-failed"))
+			})
+		})
+
+		Context("when the daemon does not complete the handshake in time", func() {
+			var (
+				silentListener net.Listener
+				daemonClosed   chan struct{}
+			)
+
+			BeforeEach(func() {
+				var err error
+				silentListener, err = net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+
+				daemonClosed = make(chan struct{})
+				go func() {
+					conn, err := silentListener.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+
+					io.Copy(ioutil.Discard, conn)
+					close(daemonClosed)
+				}()
+
+				permissions.CriticalOptions["proxy-target-config"] = fmt.Sprintf(`{ "address": "%s" }`, silentListener.Addr().String())
+				handshakeTimeout = 100 * time.Millisecond
+			})
+
+			AfterEach(func() {
+				silentListener.Close()
+			})
+
+			It("returns an error", func() {
+				Expect(newClientConnErr).To(HaveOccurred())
+			})
+
+			It("logs the failure", func() {
+				Eventually(logger).Should(gbytes.Say("handshake-failed"))
+			})
+
+			It("closes the connection to the daemon", func() {
+				Eventually(daemonClosed).Should(BeClosed())
+			})
+		})
+
 		Context("when the config contains a user and password", func() {
 			var passwordAuthenticator *fake_authenticators.FakePasswordAuthenticator
 
@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type TCPRouteMapping struct {
+	RouterGroupGuid string `json:"router_group_guid"`
+	Port            uint16 `json:"port"`
+	BackendIP       string `json:"backend_ip"`
+	BackendPort     uint16 `json:"backend_port"`
+	TTL             int    `json:"ttl"`
+}
+
+//go:generate counterfeiter -o fake_routing/fake_client.go . Client
+type Client interface {
+	UpsertTCPRouteMappings(logger lager.Logger, mappings []TCPRouteMapping) error
+	DeleteTCPRouteMappings(logger lager.Logger, mappings []TCPRouteMapping) error
+}
+
+type uaaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+}
+
+type client struct {
+	httpClient      *http.Client
+	routingAPIURL   string
+	uaaTokenURL     string
+	uaaClientID     string
+	uaaClientSecret string
+}
+
+// NewClient returns a routing API client that authenticates with a UAA
+// client credentials token. A token is requested for every call; calls are
+// infrequent and this avoids tracking token expiry.
+func NewClient(
+	httpClient *http.Client,
+	routingAPIURL string,
+	uaaTokenURL string,
+	uaaClientID string,
+	uaaClientSecret string,
+) Client {
+	return &client{
+		httpClient:      httpClient,
+		routingAPIURL:   strings.TrimRight(routingAPIURL, "/"),
+		uaaTokenURL:     uaaTokenURL,
+		uaaClientID:     uaaClientID,
+		uaaClientSecret: uaaClientSecret,
+	}
+}
+
+func (c *client) UpsertTCPRouteMappings(logger lager.Logger, mappings []TCPRouteMapping) error {
+	return c.post(logger.Session("upsert-tcp-route-mappings"), "/routing/v1/tcp_routes/create", mappings)
+}
+
+func (c *client) DeleteTCPRouteMappings(logger lager.Logger, mappings []TCPRouteMapping) error {
+	return c.post(logger.Session("delete-tcp-route-mappings"), "/routing/v1/tcp_routes/delete", mappings)
+}
+
+func (c *client) post(logger lager.Logger, path string, mappings []TCPRouteMapping) error {
+	token, err := c.fetchToken(logger)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(mappings)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.routingAPIURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.Error("request-failed", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("routing api responded with status %d", resp.StatusCode)
+		logger.Error("response-status-not-ok", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *client) fetchToken(logger lager.Logger) (string, error) {
+	logger = logger.Session("fetch-token")
+
+	formValues := make(url.Values)
+	formValues.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequest("POST", c.uaaTokenURL, strings.NewReader(formValues.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.SetBasicAuth(c.uaaClientID, c.uaaClientSecret)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.Error("request-failed", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("uaa responded with status %d", resp.StatusCode)
+		logger.Error("response-status-not-ok", err)
+		return "", err
+	}
+
+	var tokenResponse uaaTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+	if err != nil {
+		logger.Error("decode-token-response-failed", err)
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s", tokenResponse.TokenType, tokenResponse.AccessToken), nil
+}
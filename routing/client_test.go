@@ -0,0 +1,103 @@
+package routing_test
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/diego-ssh/routing"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/onsi/gomega/ghttp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		logger     *lagertest.TestLogger
+		fakeUAA    *ghttp.Server
+		fakeRouter *ghttp.Server
+		client     routing.Client
+		mappings   []routing.TCPRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeUAA = ghttp.NewServer()
+		fakeRouter = ghttp.NewServer()
+
+		fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.CombineHandlers(
+			ghttp.VerifyBasicAuth("proxy-client", "proxy-secret"),
+			ghttp.VerifyFormKV("grant_type", "client_credentials"),
+			ghttp.RespondWithJSONEncoded(http.StatusOK, map[string]string{
+				"access_token": "the-token",
+				"token_type":   "bearer",
+			}),
+		))
+
+		client = routing.NewClient(http.DefaultClient, fakeRouter.URL()+"/", fakeUAA.URL()+"/oauth/token", "proxy-client", "proxy-secret")
+
+		mappings = []routing.TCPRouteMapping{{
+			RouterGroupGuid: "router-group-guid",
+			Port:            2222,
+			BackendIP:       "10.0.0.1",
+			BackendPort:     2222,
+			TTL:             120,
+		}}
+	})
+
+	AfterEach(func() {
+		fakeUAA.Close()
+		fakeRouter.Close()
+	})
+
+	Describe("UpsertTCPRouteMappings", func() {
+		It("creates the mappings with a UAA token", func() {
+			fakeRouter.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/routing/v1/tcp_routes/create"),
+				ghttp.VerifyHeaderKV("Authorization", "bearer the-token"),
+				ghttp.VerifyJSON(`[{"router_group_guid":"router-group-guid","port":2222,"backend_ip":"10.0.0.1","backend_port":2222,"ttl":120}]`),
+				ghttp.RespondWith(http.StatusCreated, nil),
+			))
+
+			Expect(client.UpsertTCPRouteMappings(logger, mappings)).To(Succeed())
+			Expect(fakeRouter.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		Context("when the routing api fails", func() {
+			BeforeEach(func() {
+				fakeRouter.AppendHandlers(ghttp.RespondWith(http.StatusInternalServerError, nil))
+			})
+
+			It("returns an error", func() {
+				err := client.UpsertTCPRouteMappings(logger, mappings)
+				Expect(err).To(MatchError("routing api responded with status 500"))
+			})
+		})
+
+		Context("when a token cannot be fetched", func() {
+			BeforeEach(func() {
+				fakeUAA.RouteToHandler("POST", "/oauth/token", ghttp.RespondWith(http.StatusUnauthorized, nil))
+			})
+
+			It("returns an error without contacting the routing api", func() {
+				err := client.UpsertTCPRouteMappings(logger, mappings)
+				Expect(err).To(MatchError("uaa responded with status 401"))
+				Expect(fakeRouter.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("DeleteTCPRouteMappings", func() {
+		It("deletes the mappings with a UAA token", func() {
+			fakeRouter.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/routing/v1/tcp_routes/delete"),
+				ghttp.VerifyHeaderKV("Authorization", "bearer the-token"),
+				ghttp.VerifyJSON(`[{"router_group_guid":"router-group-guid","port":2222,"backend_ip":"10.0.0.1","backend_port":2222,"ttl":120}]`),
+				ghttp.RespondWith(http.StatusNoContent, nil),
+			))
+
+			Expect(client.DeleteTCPRouteMappings(logger, mappings)).To(Succeed())
+			Expect(fakeRouter.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,134 @@
+// This file was generated by counterfeiter
+package fake_routing
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/diego-ssh/routing"
+	"code.cloudfoundry.org/lager"
+)
+
+type FakeClient struct {
+	UpsertTCPRouteMappingsStub        func(logger lager.Logger, mappings []routing.TCPRouteMapping) error
+	upsertTCPRouteMappingsMutex       sync.RWMutex
+	upsertTCPRouteMappingsArgsForCall []struct {
+		logger   lager.Logger
+		mappings []routing.TCPRouteMapping
+	}
+	upsertTCPRouteMappingsReturns struct {
+		result1 error
+	}
+	DeleteTCPRouteMappingsStub        func(logger lager.Logger, mappings []routing.TCPRouteMapping) error
+	deleteTCPRouteMappingsMutex       sync.RWMutex
+	deleteTCPRouteMappingsArgsForCall []struct {
+		logger   lager.Logger
+		mappings []routing.TCPRouteMapping
+	}
+	deleteTCPRouteMappingsReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeClient) UpsertTCPRouteMappings(logger lager.Logger, mappings []routing.TCPRouteMapping) error {
+	var mappingsCopy []routing.TCPRouteMapping
+	if mappings != nil {
+		mappingsCopy = make([]routing.TCPRouteMapping, len(mappings))
+		copy(mappingsCopy, mappings)
+	}
+	fake.upsertTCPRouteMappingsMutex.Lock()
+	fake.upsertTCPRouteMappingsArgsForCall = append(fake.upsertTCPRouteMappingsArgsForCall, struct {
+		logger   lager.Logger
+		mappings []routing.TCPRouteMapping
+	}{logger, mappingsCopy})
+	fake.recordInvocation("UpsertTCPRouteMappings", []interface{}{logger, mappingsCopy})
+	fake.upsertTCPRouteMappingsMutex.Unlock()
+	if fake.UpsertTCPRouteMappingsStub != nil {
+		return fake.UpsertTCPRouteMappingsStub(logger, mappings)
+	} else {
+		return fake.upsertTCPRouteMappingsReturns.result1
+	}
+}
+
+func (fake *FakeClient) UpsertTCPRouteMappingsCallCount() int {
+	fake.upsertTCPRouteMappingsMutex.RLock()
+	defer fake.upsertTCPRouteMappingsMutex.RUnlock()
+	return len(fake.upsertTCPRouteMappingsArgsForCall)
+}
+
+func (fake *FakeClient) UpsertTCPRouteMappingsArgsForCall(i int) (lager.Logger, []routing.TCPRouteMapping) {
+	fake.upsertTCPRouteMappingsMutex.RLock()
+	defer fake.upsertTCPRouteMappingsMutex.RUnlock()
+	return fake.upsertTCPRouteMappingsArgsForCall[i].logger, fake.upsertTCPRouteMappingsArgsForCall[i].mappings
+}
+
+func (fake *FakeClient) UpsertTCPRouteMappingsReturns(result1 error) {
+	fake.UpsertTCPRouteMappingsStub = nil
+	fake.upsertTCPRouteMappingsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) DeleteTCPRouteMappings(logger lager.Logger, mappings []routing.TCPRouteMapping) error {
+	var mappingsCopy []routing.TCPRouteMapping
+	if mappings != nil {
+		mappingsCopy = make([]routing.TCPRouteMapping, len(mappings))
+		copy(mappingsCopy, mappings)
+	}
+	fake.deleteTCPRouteMappingsMutex.Lock()
+	fake.deleteTCPRouteMappingsArgsForCall = append(fake.deleteTCPRouteMappingsArgsForCall, struct {
+		logger   lager.Logger
+		mappings []routing.TCPRouteMapping
+	}{logger, mappingsCopy})
+	fake.recordInvocation("DeleteTCPRouteMappings", []interface{}{logger, mappingsCopy})
+	fake.deleteTCPRouteMappingsMutex.Unlock()
+	if fake.DeleteTCPRouteMappingsStub != nil {
+		return fake.DeleteTCPRouteMappingsStub(logger, mappings)
+	} else {
+		return fake.deleteTCPRouteMappingsReturns.result1
+	}
+}
+
+func (fake *FakeClient) DeleteTCPRouteMappingsCallCount() int {
+	fake.deleteTCPRouteMappingsMutex.RLock()
+	defer fake.deleteTCPRouteMappingsMutex.RUnlock()
+	return len(fake.deleteTCPRouteMappingsArgsForCall)
+}
+
+func (fake *FakeClient) DeleteTCPRouteMappingsArgsForCall(i int) (lager.Logger, []routing.TCPRouteMapping) {
+	fake.deleteTCPRouteMappingsMutex.RLock()
+	defer fake.deleteTCPRouteMappingsMutex.RUnlock()
+	return fake.deleteTCPRouteMappingsArgsForCall[i].logger, fake.deleteTCPRouteMappingsArgsForCall[i].mappings
+}
+
+func (fake *FakeClient) DeleteTCPRouteMappingsReturns(result1 error) {
+	fake.DeleteTCPRouteMappingsStub = nil
+	fake.deleteTCPRouteMappingsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.upsertTCPRouteMappingsMutex.RLock()
+	defer fake.upsertTCPRouteMappingsMutex.RUnlock()
+	fake.deleteTCPRouteMappingsMutex.RLock()
+	defer fake.deleteTCPRouteMappingsMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *FakeClient) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ routing.Client = new(FakeClient)
@@ -0,0 +1 @@
+package routing // import "code.cloudfoundry.org/diego-ssh/routing"
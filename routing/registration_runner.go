@@ -0,0 +1,73 @@
+package routing
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+// RegistrationRunner registers TCP route mappings when it starts, refreshes
+// them every interval so they do not expire, and deletes them when it is
+// signaled. Registration failures are logged and retried on the next
+// interval rather than preventing the proxy from starting.
+type RegistrationRunner struct {
+	logger   lager.Logger
+	client   Client
+	mappings []TCPRouteMapping
+	interval time.Duration
+	clock    clock.Clock
+}
+
+func NewRegistrationRunner(
+	logger lager.Logger,
+	client Client,
+	mappings []TCPRouteMapping,
+	interval time.Duration,
+	clock clock.Clock,
+) *RegistrationRunner {
+	return &RegistrationRunner{
+		logger:   logger.Session("route-registration"),
+		client:   client,
+		mappings: mappings,
+		interval: interval,
+		clock:    clock,
+	}
+}
+
+func (r *RegistrationRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.register()
+	close(ready)
+
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			r.register()
+		case <-signals:
+			r.deregister()
+			return nil
+		}
+	}
+}
+
+func (r *RegistrationRunner) register() {
+	err := r.client.UpsertTCPRouteMappings(r.logger, r.mappings)
+	if err != nil {
+		r.logger.Error("failed-to-register-routes", err)
+		return
+	}
+	r.logger.Debug("registered-routes", lager.Data{"mappings": r.mappings})
+}
+
+func (r *RegistrationRunner) deregister() {
+	err := r.client.DeleteTCPRouteMappings(r.logger, r.mappings)
+	if err != nil {
+		r.logger.Error("failed-to-deregister-routes", err)
+		return
+	}
+	r.logger.Info("deregistered-routes", lager.Data{"mappings": r.mappings})
+}
@@ -0,0 +1,91 @@
+package routing_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/diego-ssh/routing"
+	"code.cloudfoundry.org/diego-ssh/routing/fake_routing"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RegistrationRunner", func() {
+	var (
+		logger     *lagertest.TestLogger
+		fakeClient *fake_routing.FakeClient
+		fakeClock  *fakeclock.FakeClock
+		mappings   []routing.TCPRouteMapping
+
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeClient = &fake_routing.FakeClient{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+
+		mappings = []routing.TCPRouteMapping{{
+			RouterGroupGuid: "router-group-guid",
+			Port:            2222,
+			BackendIP:       "10.0.0.1",
+			BackendPort:     2222,
+			TTL:             120,
+		}}
+	})
+
+	JustBeforeEach(func() {
+		runner := routing.NewRegistrationRunner(logger, fakeClient, mappings, 40*time.Second, fakeClock)
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("registers the routes before becoming ready", func() {
+		Expect(fakeClient.UpsertTCPRouteMappingsCallCount()).To(Equal(1))
+
+		_, actualMappings := fakeClient.UpsertTCPRouteMappingsArgsForCall(0)
+		Expect(actualMappings).To(Equal(mappings))
+	})
+
+	It("refreshes the routes every interval", func() {
+		fakeClock.WaitForWatcherAndIncrement(40 * time.Second)
+		Eventually(fakeClient.UpsertTCPRouteMappingsCallCount).Should(Equal(2))
+
+		fakeClock.WaitForWatcherAndIncrement(40 * time.Second)
+		Eventually(fakeClient.UpsertTCPRouteMappingsCallCount).Should(Equal(3))
+	})
+
+	It("deregisters the routes when signaled", func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+
+		Expect(fakeClient.DeleteTCPRouteMappingsCallCount()).To(Equal(1))
+
+		_, actualMappings := fakeClient.DeleteTCPRouteMappingsArgsForCall(0)
+		Expect(actualMappings).To(Equal(mappings))
+	})
+
+	Context("when registration fails", func() {
+		BeforeEach(func() {
+			fakeClient.UpsertTCPRouteMappingsReturns(errors.New("boom"))
+		})
+
+		It("becomes ready and retries on the next interval", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+			Expect(logger).To(gbytes.Say("failed-to-register-routes"))
+
+			fakeClock.WaitForWatcherAndIncrement(40 * time.Second)
+			Eventually(fakeClient.UpsertTCPRouteMappingsCallCount).Should(Equal(2))
+		})
+	})
+})
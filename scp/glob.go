@@ -0,0 +1,119 @@
+package scp
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ExpandGlob expands a source path the way a shell would before handing it
+// to scp: brace alternatives are expanded first, then each resulting pattern
+// is matched against the file system. Wildcards do not match a leading dot
+// unless the pattern component starts with one. Patterns that are malformed
+// or match nothing are returned as-is so the caller reports the missing file.
+func ExpandGlob(pattern string) []string {
+	sources := []string{}
+
+	for _, expanded := range expandBraces(pattern) {
+		matches, err := filepath.Glob(expanded)
+		if err != nil {
+			sources = append(sources, expanded)
+			continue
+		}
+
+		matches = withoutHiddenMatches(expanded, matches)
+		if len(matches) == 0 {
+			sources = append(sources, expanded)
+			continue
+		}
+
+		sources = append(sources, matches...)
+	}
+
+	return sources
+}
+
+func expandBraces(pattern string) []string {
+	open, close, alternatives := findBraces(pattern)
+	if open < 0 {
+		return []string{pattern}
+	}
+
+	prefix := pattern[:open]
+	suffix := pattern[close+1:]
+
+	expanded := []string{}
+	for _, alternative := range alternatives {
+		expanded = append(expanded, expandBraces(prefix+alternative+suffix)...)
+	}
+
+	return expanded
+}
+
+// findBraces locates the first brace group that contains a top level comma
+// and returns its bounds and alternatives. Groups without a comma, such as
+// a literal "{}", are left alone.
+func findBraces(pattern string) (int, int, []string) {
+	for open := 0; open < len(pattern); open++ {
+		if pattern[open] == '\\' {
+			open++
+			continue
+		}
+		if pattern[open] != '{' {
+			continue
+		}
+
+		depth := 0
+		start := open + 1
+		alternatives := []string{}
+
+		for i := open; i < len(pattern); i++ {
+			switch pattern[i] {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case ',':
+				if depth == 1 {
+					alternatives = append(alternatives, pattern[start:i])
+					start = i + 1
+				}
+			case '}':
+				depth--
+				if depth == 0 {
+					if len(alternatives) == 0 {
+						break
+					}
+					return open, i, append(alternatives, pattern[start:i])
+				}
+			}
+			if depth == 0 {
+				break
+			}
+		}
+	}
+
+	return -1, -1, nil
+}
+
+func withoutHiddenMatches(pattern string, matches []string) []string {
+	patternParts := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+
+	visible := []string{}
+	for _, match := range matches {
+		matchParts := strings.Split(match, string(filepath.Separator))
+		if len(matchParts) != len(patternParts) || !hidesDotFiles(patternParts, matchParts) {
+			visible = append(visible, match)
+		}
+	}
+
+	return visible
+}
+
+func hidesDotFiles(patternParts, matchParts []string) bool {
+	for i, part := range matchParts {
+		if strings.HasPrefix(part, ".") && !strings.HasPrefix(patternParts[i], ".") {
+			return true
+		}
+	}
+	return false
+}
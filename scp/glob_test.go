@@ -0,0 +1,92 @@
+package scp_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/diego-ssh/scp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExpandGlob", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scp-glob")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"app.log", "web.log", "notes.txt", ".hidden.log"} {
+			err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		err = os.Mkdir(filepath.Join(dir, "logs"), 0755)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(dir, "logs", "staging.log"), []byte("staging"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("expands wildcards in sorted order", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, "*.log"))).To(Equal([]string{
+			filepath.Join(dir, "app.log"),
+			filepath.Join(dir, "web.log"),
+		}))
+	})
+
+	It("expands wildcards in directory components", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, "*", "*.log"))).To(Equal([]string{
+			filepath.Join(dir, "logs", "staging.log"),
+		}))
+	})
+
+	It("matches dot files only when the pattern starts with a dot", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, ".*.log"))).To(Equal([]string{
+			filepath.Join(dir, ".hidden.log"),
+		}))
+	})
+
+	It("expands brace alternatives in order", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, "{web,notes}.*"))).To(Equal([]string{
+			filepath.Join(dir, "web.log"),
+			filepath.Join(dir, "notes.txt"),
+		}))
+	})
+
+	It("expands nested brace alternatives", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, "{app,{web,notes}}.log"))).To(Equal([]string{
+			filepath.Join(dir, "app.log"),
+			filepath.Join(dir, "web.log"),
+			filepath.Join(dir, "notes.log"),
+		}))
+	})
+
+	It("leaves braces without alternatives alone", func() {
+		Expect(scp.ExpandGlob(filepath.Join(dir, "{}.log"))).To(Equal([]string{
+			filepath.Join(dir, "{}.log"),
+		}))
+	})
+
+	Context("when a pattern matches nothing", func() {
+		It("returns the pattern literally", func() {
+			Expect(scp.ExpandGlob(filepath.Join(dir, "*.dat"))).To(Equal([]string{
+				filepath.Join(dir, "*.dat"),
+			}))
+		})
+	})
+
+	Context("when a pattern is malformed", func() {
+		It("returns the pattern literally", func() {
+			Expect(scp.ExpandGlob(filepath.Join(dir, "["))).To(Equal([]string{
+				filepath.Join(dir, "["),
+			}))
+		})
+	})
+})
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 
 	"code.cloudfoundry.org/lager"
@@ -63,11 +62,7 @@ func (s *secureCopy) Copy() error {
 
 		for _, sourceGlob := range s.options.Sources {
 			logger.Debug("evaluating-glob", lager.Data{"Source Glob": sourceGlob})
-			sources, err := filepath.Glob(sourceGlob)
-			if err != nil || len(sources) == 0 {
-				logger.Debug("failed-matching-glob", lager.Data{"Source Glob": sourceGlob})
-				sources = []string{sourceGlob}
-			}
+			sources := ExpandGlob(sourceGlob)
 
 			for _, source := range sources {
 				logger.Debug("sending-source", lager.Data{"Source": source})
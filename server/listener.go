@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd socket activation.
+const systemdListenFDsStart = 3
+
+// InheritedListener creates a listener from a file descriptor inherited from
+// the parent process.
+func InheritedListener(fd uintptr) (net.Listener, error) {
+	file := os.NewFile(fd, fmt.Sprintf("inherited-listener-%d", fd))
+	if file == nil {
+		return nil, fmt.Errorf("invalid listener file descriptor: %d", fd)
+	}
+	defer file.Close()
+
+	return net.FileListener(file)
+}
+
+// SystemdListener returns the first listener passed to the process by systemd
+// socket activation. When the process was not socket activated, a nil listener
+// is returned.
+func SystemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	return InheritedListener(systemdListenFDsStart)
+}
+
+// InheritListenerArgs returns args with any existing flagName flag removed,
+// whether its value is attached with "=" or passed as the next argument, and
+// with flagName set to fd appended. It is used to build the arguments of a
+// process that inherits the listener.
+func InheritListenerArgs(args []string, flagName string, fd uintptr) []string {
+	filtered := []string{}
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if name == args[i] {
+			filtered = append(filtered, args[i])
+			continue
+		}
+
+		if name == flagName {
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(name, flagName+"=") {
+			continue
+		}
+
+		filtered = append(filtered, args[i])
+	}
+
+	return append(filtered, fmt.Sprintf("-%s=%d", flagName, fd))
+}
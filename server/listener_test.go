@@ -0,0 +1,98 @@
+package server_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/diego-ssh/server"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	Describe("InheritedListener", func() {
+		var listener *net.TCPListener
+
+		BeforeEach(func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			listener = l.(*net.TCPListener)
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("accepts connections on the inherited file descriptor", func() {
+			file, err := listener.File()
+			Expect(err).NotTo(HaveOccurred())
+
+			inherited, err := server.InheritedListener(file.Fd())
+			Expect(err).NotTo(HaveOccurred())
+			defer inherited.Close()
+
+			Expect(listener.Close()).To(Succeed())
+
+			go net.Dial("tcp", inherited.Addr().String())
+
+			conn, err := inherited.Accept()
+			Expect(err).NotTo(HaveOccurred())
+			conn.Close()
+		})
+	})
+
+	Describe("SystemdListener", func() {
+		AfterEach(func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+		})
+
+		Context("when the process was not socket activated", func() {
+			It("returns a nil listener", func() {
+				listener, err := server.SystemdListener()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(listener).To(BeNil())
+			})
+		})
+
+		Context("when the sockets were passed to a different process", func() {
+			BeforeEach(func() {
+				os.Setenv("LISTEN_PID", fmt.Sprintf("%d", os.Getpid()+1))
+				os.Setenv("LISTEN_FDS", "1")
+			})
+
+			It("returns a nil listener", func() {
+				listener, err := server.SystemdListener()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(listener).To(BeNil())
+			})
+		})
+	})
+
+	Describe("InheritListenerArgs", func() {
+		It("appends the listener flag", func() {
+			args := server.InheritListenerArgs([]string{"-config", "config.json"}, "inheritListenerFD", 3)
+			Expect(args).To(Equal([]string{"-config", "config.json", "-inheritListenerFD=3"}))
+		})
+
+		It("replaces a listener flag with an attached value", func() {
+			args := server.InheritListenerArgs([]string{"-inheritListenerFD=5", "-config", "config.json"}, "inheritListenerFD", 3)
+			Expect(args).To(Equal([]string{"-config", "config.json", "-inheritListenerFD=3"}))
+
+			args = server.InheritListenerArgs([]string{"--inheritListenerFD=5", "-config", "config.json"}, "inheritListenerFD", 3)
+			Expect(args).To(Equal([]string{"-config", "config.json", "-inheritListenerFD=3"}))
+		})
+
+		It("replaces a listener flag with a separate value", func() {
+			args := server.InheritListenerArgs([]string{"-inheritListenerFD", "5", "-config", "config.json"}, "inheritListenerFD", 3)
+			Expect(args).To(Equal([]string{"-config", "config.json", "-inheritListenerFD=3"}))
+		})
+
+		It("keeps other flags and values", func() {
+			args := server.InheritListenerArgs([]string{"-config", "inheritListenerFD", "-inheritListenerFDs=1"}, "inheritListenerFD", 3)
+			Expect(args).To(Equal([]string{"-config", "inheritListenerFD", "-inheritListenerFDs=1", "-inheritListenerFD=3"}))
+		})
+	})
+})
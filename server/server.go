@@ -2,12 +2,19 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"os"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/runtimeschema/metric"
+)
+
+const (
+	connectionHandlerPanics = metric.Counter("ssh-connection-handler-panics")
 )
 
 //go:generate counterfeiter -o fakes/fake_connection_handler.go . ConnectionHandler
@@ -24,6 +31,7 @@ type Server struct {
 	listener net.Listener
 	mutex    *sync.Mutex
 	stopping bool
+	draining bool
 
 	connections          map[net.Conn]struct{}
 	connectionsMutex     *sync.Mutex
@@ -47,12 +55,19 @@ func NewServer(
 }
 
 func (s *Server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
-	listener, err := net.Listen("tcp", s.listenAddress)
-	if err != nil {
-		return err
+	s.mutex.Lock()
+	hasListener := s.listener != nil
+	s.mutex.Unlock()
+
+	if !hasListener {
+		listener, err := net.Listen("tcp", s.listenAddress)
+		if err != nil {
+			return err
+		}
+
+		s.SetListener(listener)
 	}
 
-	s.SetListener(listener)
 	go s.Serve()
 
 	close(ready)
@@ -67,7 +82,6 @@ func (s *Server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 
 func (s *Server) Shutdown() {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 
 	if !s.stopping {
 		s.logger.Info("stopping-server")
@@ -81,6 +95,34 @@ func (s *Server) Shutdown() {
 		s.connectionsMutex.Unlock()
 	}
 
+	draining := s.draining
+	s.mutex.Unlock()
+
+	if !draining {
+		s.connectionsWaitGroup.Wait()
+	}
+}
+
+// Drain stops accepting new connections while allowing established
+// connections to complete. A subsequent Shutdown returns without closing or
+// waiting for the established connections; use WaitForConnections to wait
+// for them to finish.
+func (s *Server) Drain() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.stopping {
+		s.logger.Info("draining-server")
+		s.stopping = true
+		s.draining = true
+
+		if s.listener != nil {
+			s.listener.Close()
+		}
+	}
+}
+
+func (s *Server) WaitForConnections() {
 	s.connectionsWaitGroup.Wait()
 }
 
@@ -104,6 +146,27 @@ func (s *Server) SetListener(listener net.Listener) error {
 	return nil
 }
 
+// ListenerFile returns a duplicate of the listener's file descriptor. The
+// descriptor remains open after the server stops listening so it can be
+// handed to another process.
+func (s *Server) ListenerFile() (*os.File, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener == nil {
+		return nil, errors.New("No listener")
+	}
+
+	filer, ok := s.listener.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, errors.New("Listener does not support file descriptors")
+	}
+
+	return filer.File()
+}
+
 func (s *Server) ListenAddr() (net.Addr, error) {
 	if s.listener == nil {
 		return nil, errors.New("No listener")
@@ -139,12 +202,37 @@ func (s *Server) Serve() {
 		s.connectionsMutex.Unlock()
 
 		go func() {
-			s.connectionHandler.HandleConnection(netConn)
-
-			s.connectionsMutex.Lock()
-			delete(s.connections, netConn)
-			s.connectionsWaitGroup.Done()
-			s.connectionsMutex.Unlock()
+			defer func() {
+				s.connectionsMutex.Lock()
+				delete(s.connections, netConn)
+				s.connectionsWaitGroup.Done()
+				s.connectionsMutex.Unlock()
+			}()
+
+			s.handleConnection(logger, netConn)
 		}()
 	}
 }
+
+// handleConnection isolates the accept loop from a misbehaving connection
+// handler. A panic is logged, counted, and the offending connection closed.
+func (s *Server) handleConnection(logger lager.Logger, netConn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			data := lager.Data{"stack": string(debug.Stack())}
+			if addr := netConn.RemoteAddr(); addr != nil {
+				data["remote-addr"] = addr.String()
+			}
+			logger.Error("connection-handler-panicked", fmt.Errorf("%v", r), data)
+
+			err := connectionHandlerPanics.Increment()
+			if err != nil {
+				logger.Error("failed-to-send-connection-handler-panics-metric", err)
+			}
+
+			netConn.Close()
+		}
+	}()
+
+	s.connectionHandler.HandleConnection(netConn)
+}
@@ -67,6 +67,40 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	Describe("Run with a listener", func() {
+		var (
+			process  ifrit.Process
+			listener net.Listener
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			srv = server.NewServer(logger, address, handler)
+			Expect(srv.SetListener(listener)).To(Succeed())
+
+			process = ifrit.Invoke(srv)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("accepts connections on the listener", func() {
+			_, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(handler.HandleConnectionCallCount).Should(Equal(1))
+		})
+
+		It("does not listen on the specified address", func() {
+			_, err := net.Dial("tcp", address)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("SetListener", func() {
 		var fakeListener *fake_net.FakeListener
 
@@ -123,6 +157,26 @@ var _ = Describe("Server", func() {
 			Expect(handler.HandleConnectionArgsForCall(0)).To(Equal(fakeConn))
 		})
 
+		Context("when the connection handler panics", func() {
+			BeforeEach(func() {
+				handler.HandleConnectionStub = func(net.Conn) {
+					panic("boom")
+				}
+			})
+
+			It("continues accepting connections", func() {
+				Expect(fakeListener.AcceptCallCount()).To(Equal(2))
+			})
+
+			It("logs the panic", func() {
+				Eventually(logger).Should(gbytes.Say("test.serve.connection-handler-panicked"))
+			})
+
+			It("closes the connection", func() {
+				Eventually(fakeConn.CloseCallCount).Should(Equal(1))
+			})
+		})
+
 		Context("when accept returns a permanent error", func() {
 			BeforeEach(func() {
 				fakeListener.AcceptReturns(nil, errors.New("oops"))
@@ -198,6 +252,123 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	Describe("Drain", func() {
+		var (
+			listener    net.Listener
+			clientConn  net.Conn
+			established chan net.Conn
+			finish      chan struct{}
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			established = make(chan net.Conn, 1)
+			finish = make(chan struct{})
+			handler.HandleConnectionStub = func(conn net.Conn) {
+				established <- conn
+				<-finish
+			}
+
+			srv = server.NewServer(logger, address, handler)
+			Expect(srv.SetListener(listener)).To(Succeed())
+			go srv.Serve()
+
+			clientConn, err = net.Dial("tcp", listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(established).Should(HaveLen(1))
+
+			srv.Drain()
+		})
+
+		AfterEach(func() {
+			close(finish)
+			clientConn.Close()
+		})
+
+		It("marks the server as stopping", func() {
+			Expect(srv.IsStopping()).To(BeTrue())
+		})
+
+		It("stops accepting connections", func() {
+			Eventually(func() error {
+				_, err := net.Dial("tcp", listener.Addr().String())
+				return err
+			}).Should(HaveOccurred())
+		})
+
+		It("does not close established connections when shutdown", func() {
+			srv.Shutdown()
+
+			conn := <-established
+			_, err := conn.Write([]byte("hello"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("waits for established connections to complete", func() {
+			done := make(chan struct{})
+			go func() {
+				srv.WaitForConnections()
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			finish <- struct{}{}
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Describe("ListenerFile", func() {
+		BeforeEach(func() {
+			srv = server.NewServer(logger, address, handler)
+		})
+
+		Context("when the server has a tcp listener", func() {
+			var listener net.Listener
+
+			BeforeEach(func() {
+				var err error
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(srv.SetListener(listener)).To(Succeed())
+			})
+
+			It("returns a file that outlives the listener", func() {
+				file, err := srv.ListenerFile()
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				Expect(listener.Close()).To(Succeed())
+
+				inherited, err := server.InheritedListener(file.Fd())
+				Expect(err).NotTo(HaveOccurred())
+				defer inherited.Close()
+
+				Expect(inherited.Addr()).To(Equal(listener.Addr()))
+			})
+		})
+
+		Context("when the listener does not have a file descriptor", func() {
+			BeforeEach(func() {
+				Expect(srv.SetListener(&fake_net.FakeListener{})).To(Succeed())
+			})
+
+			It("returns an error", func() {
+				_, err := srv.ListenerFile()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the server does not have a listener", func() {
+			It("returns an error", func() {
+				_, err := srv.ListenerFile()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("ListenAddr", func() {
 		var listener net.Listener
 		BeforeEach(func() {